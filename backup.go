@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ---------------- Config backups ----------------
+
+const backupTimeFormat = "20060102-150405.000000"
+
+func backupsDir() (string, error) {
+	path, err := xdgConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "backups"), nil
+}
+
+// backupConfig copies the config file at path into the backups dir as
+// "<name>.bak.<timestamp>" and prunes the oldest copies beyond keep.
+// A missing config file is not an error; nothing is backed up.
+func backupConfig(path string, keep int) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	dir, err := backupsDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(path)+".bak."+time.Now().Format(backupTimeFormat))
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		return "", err
+	}
+	return dst, pruneBackups(keep)
+}
+
+// listBackups returns backup file paths, oldest first.
+func listBackups() ([]string, error) {
+	dir, err := backupsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.Contains(e.Name(), ".bak.") {
+			res = append(res, filepath.Join(dir, e.Name()))
+		}
+	}
+	// timestamps sort lexically
+	slices.SortFunc(res, func(a, b string) int {
+		return strings.Compare(backupStamp(a), backupStamp(b))
+	})
+	return res, nil
+}
+
+func backupStamp(p string) string {
+	_, stamp, _ := strings.Cut(filepath.Base(p), ".bak.")
+	return stamp
+}
+
+func pruneBackups(keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	all, err := listBackups()
+	if err != nil {
+		return err
+	}
+	for len(all) > keep {
+		if err := os.Remove(all[0]); err != nil {
+			return err
+		}
+		all = all[1:]
+	}
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "backup-config",
+		Summary: "Back up the config file (-list to show existing backups)",
+		Run:     runBackupConfig,
+	})
+}
+
+func runBackupConfig(opts Options, args []string) error {
+	fs := flag.NewFlagSet("backup-config", flag.ContinueOnError)
+	list := fs.Bool("list", false, "List existing backups")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *list {
+		all, err := listBackups()
+		if err != nil {
+			return err
+		}
+		for _, p := range all {
+			fmt.Println(p)
+		}
+		return nil
+	}
+
+	path := resolveConfigFile(opts.ConfigPath)
+	if path == "" {
+		return ErrConfigNotFound
+	}
+	cfg, err := loadConfig(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	dst, err := backupConfig(path, cfg.MaxConfigBackups)
+	if err != nil {
+		return err
+	}
+	if dst == "" {
+		return fmt.Errorf("%w: %s", ErrConfigNotFound, path)
+	}
+	fmt.Printf("Backed up %s → %s\n", path, dst)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ---------------- bootstrap ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "bootstrap",
+		Summary: "Install the tsm config from a dotfiles checkout: bootstrap <dotfiles-dir>",
+		Run:     runBootstrap,
+	})
+}
+
+// bootstrapSource returns the tsm config directory inside a dotfiles
+// checkout: <dir>/tsm or <dir>/.config/tsm, whichever has a config file.
+func bootstrapSource(dotfiles string) (string, error) {
+	for _, sub := range []string{"tsm", filepath.Join(".config", "tsm")} {
+		dir := filepath.Join(dotfiles, sub)
+		if findConfigFile(dir) != "" {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no tsm/ or .config/tsm/ with a config file in %s", ErrConfigNotFound, dotfiles)
+}
+
+// copyTree copies the files under src into dst, creating directories as
+// needed and overwriting files that already exist.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func runBootstrap(_ Options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tsm bootstrap <dotfiles-dir>")
+	}
+	dotfiles, ok := expandPath(args[0])
+	if !ok {
+		return fmt.Errorf("cannot resolve path %q", args[0])
+	}
+	src, err := bootstrapSource(dotfiles)
+	if err != nil {
+		return err
+	}
+	cfgPath, err := xdgConfigPath()
+	if err != nil {
+		return err
+	}
+	dst := filepath.Dir(cfgPath)
+
+	existing := configFiles(dst)
+	if len(existing) > 0 {
+		if !confirm(fmt.Sprintf("Overwrite the config in %s with %s?", dst, src)) {
+			return ErrCancelled
+		}
+		cfg, _ := loadConfig("") // best-effort: only for max_config_backups
+		for _, p := range existing {
+			if _, err := backupConfig(p, cfg.MaxConfigBackups); err != nil {
+				return fmt.Errorf("backup: %w", err)
+			}
+		}
+	}
+	if err := copyTree(src, dst); err != nil {
+		return err
+	}
+	fmt.Printf("Copied %s → %s\n", src, dst)
+
+	// an old config in another format would otherwise shadow or sit
+	// beside the new one; it was backed up above
+	installed := filepath.Base(findConfigFile(src))
+	for _, p := range existing {
+		if filepath.Base(p) == installed {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s (backed up)\n", p)
+	}
+	return lintConfigFile(findConfigFile(dst))
+}
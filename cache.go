@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------- Scan cache ----------------
+
+const defaultCacheTTL = 5 * time.Minute
+
+// scanCache remembers the project roots found under each top-level
+// directory of the scan paths so unchanged subtrees need not be walked.
+type scanCache struct {
+	Key     string       `json:"key"` // scan settings the entries were made with
+	Entries []cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	Path      string    `json:"path"`  // top-level directory of a scan path
+	MTime     time.Time `json:"mtime"` // its modification time when walked
+	ScannedAt time.Time `json:"scanned_at"`
+	Repos     []string  `json:"repos"`
+}
+
+func xdgCacheDir() (string, error) {
+	xdg := os.Getenv("XDG_CACHE_HOME")
+	if xdg == "" {
+		home, _ := os.UserHomeDir()
+		if home == "" {
+			return "", errors.New("cannot resolve $HOME for XDG")
+		}
+		xdg = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(xdg, appName), nil
+}
+
+func scanCachePath() (string, error) {
+	dir, err := xdgCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "repos.json"), nil
+}
+
+// scanCacheKey fingerprints the settings that change what a walk finds, so
+// a cache written with different settings is ignored.
+func scanCacheKey(cfg Config) string {
+	return fmt.Sprintf("depth=%d follow=%t exclude=%q markers=%q",
+		cfg.MaxDepth, cfg.FollowSymlinks, cfg.Exclude, cfg.ProjectMarkers)
+}
+
+// loadScanCache returns the entries in path by directory. A missing or
+// unreadable cache, or one made with another key, yields no entries.
+func loadScanCache(path, key string) map[string]cacheEntry {
+	entries := map[string]cacheEntry{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entries
+	}
+	var c scanCache
+	if json.Unmarshal(data, &c) != nil || c.Key != key {
+		return entries
+	}
+	for _, e := range c.Entries {
+		entries[e.Path] = e
+	}
+	return entries
+}
+
+func saveScanCache(path string, c scanCache) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// scanRepos lists project roots, through the scan cache unless it is
+// disabled by -no-cache or a zero cache_ttl.
+func scanRepos(cfg Config) []string {
+	if cfg.NoCache || cfg.CacheTTL <= 0 {
+		return scanGitReposConcurrent(cfg)
+	}
+	path, err := scanCachePath()
+	if err != nil {
+		return scanGitReposConcurrent(cfg)
+	}
+	return scanReposCached(cfg, path, cfg.RefreshCache, time.Now())
+}
+
+// scanReposCached is scanGitReposConcurrent backed by the cache at path: a
+// top-level directory whose mtime is unchanged and whose entry is younger
+// than cfg.CacheTTL contributes its cached repos instead of being walked.
+// With refresh every subtree is walked. The cache is rewritten either way.
+func scanReposCached(cfg Config, path string, refresh bool, now time.Time) []string {
+	key := scanCacheKey(cfg)
+	old := map[string]cacheEntry{}
+	if !refresh {
+		old = loadScanCache(path, key)
+	}
+
+	var mu sync.Mutex
+	next := map[string]cacheEntry{}
+	walked := map[string]bool{}
+	var reused []string
+	s := newRepoScanner(cfg)
+	s.descend = func(dir string) bool {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if e, ok := old[dir]; ok && e.MTime.Equal(fi.ModTime()) && now.Sub(e.ScannedAt) < cfg.CacheTTL {
+			next[dir] = e
+			reused = append(reused, e.Repos...)
+			return false
+		}
+		next[dir] = cacheEntry{Path: dir, MTime: fi.ModTime(), ScannedAt: now}
+		walked[dir] = true
+		return true
+	}
+	repos := s.scan()
+
+	for dir := range walked {
+		e := next[dir]
+		prefix := dir + string(filepath.Separator)
+		for _, r := range repos {
+			if r == dir || strings.HasPrefix(r, prefix) {
+				e.Repos = append(e.Repos, r)
+			}
+		}
+		next[dir] = e
+	}
+	c := scanCache{Key: key}
+	for _, dir := range slices.Sorted(maps.Keys(next)) {
+		c.Entries = append(c.Entries, next[dir])
+	}
+	if err := saveScanCache(path, c); err != nil {
+		slog.Debug("scan cache not saved", "path", path, "err", err)
+	}
+
+	repos = append(repos, reused...)
+	slices.Sort(repos)
+	return slices.Compact(repos)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ---------------- Clipboard ----------------
+
+// clipboardCommand picks the first available clipboard tool for the platform.
+func clipboardCommand() (string, []string, error) {
+	var cands [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		cands = [][]string{{"pbcopy"}}
+	case "windows":
+		cands = [][]string{{"clip.exe"}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			cands = append(cands, []string{"wl-copy"})
+		}
+		cands = append(cands,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+			[]string{"clip.exe"}, // WSL
+		)
+	}
+	for _, c := range cands {
+		if shell.IsAvailable(c[0]) {
+			return c[0], c[1:], nil
+		}
+	}
+	return "", nil, errors.New("no clipboard tool found (install xclip, wl-copy or pbcopy)")
+}
+
+func copyToClipboard(ctx context.Context, text string) error {
+	name, args, err := clipboardCommand()
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// copySelection copies the item's path, or its session name when name is set.
+func copySelection(ctx context.Context, it Item, name bool) error {
+	text := it.Path
+	if name {
+		text = it.Name
+	} else if text == "" {
+		return fmt.Errorf("%q has no path to copy", it.Name)
+	}
+	if err := copyToClipboard(ctx, text); err != nil {
+		return err
+	}
+	fmt.Printf("Copied %s\n", text)
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "copy-path",
+		Summary:     "Copy an item's path to the clipboard: copy-path [-session-name] [name]",
+		Run:         runCopyPath,
+		SessionArgs: true,
+	})
+}
+
+// runCopyPath copies the named item, or opens the picker when no name is
+// given, without switching sessions.
+func runCopyPath(opts Options, args []string) error {
+	fs := flag.NewFlagSet("copy-path", flag.ContinueOnError)
+	sessName := fs.Bool("session-name", false, "Copy the session name instead of the path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: tsm copy-path [-session-name] [name]")
+	}
+	if fs.NArg() == 0 {
+		opts.Clipboard, opts.ClipboardName = true, *sessName
+		return Run(opts)
+	}
+
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := cfg.matchOptions()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	it, ok := findItem(buildItems(ctx, cfg), fs.Arg(0), false, m)
+	if !ok {
+		return fmt.Errorf("no item matches %q", fs.Arg(0))
+	}
+	return copySelection(ctx, it, *sessName)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ---------------- Subcommands ----------------
+
+// Command is a named subcommand invoked as `tsm <name> [args...]`.
+type Command struct {
+	Name    string
+	Summary string
+	Run     func(opts Options, args []string) error
+	// SessionArgs marks commands whose positional args are session names,
+	// so shell completion can offer running sessions.
+	SessionArgs bool
+}
+
+var commands = map[string]Command{}
+
+func registerCommand(c Command) { commands[c.Name] = c }
+
+func init() {
+	registerCommand(Command{
+		Name:    "version",
+		Summary: "Print version and exit",
+		Run: func(Options, []string) error {
+			fmt.Printf("tsm %s (commit %s, built %s)\n", version, commit, date)
+			return nil
+		},
+	})
+}
+
+// resolveCommand picks the subcommand to run from the positional args.
+// An explicit subcommand always wins; TSM_DEFAULT_COMMAND is only consulted
+// for a bare `tsm`, with no positional args and no flags (nflags), so runs
+// such as `tsm -print` keep the picker flow. ok is false when the picker
+// should run.
+func resolveCommand(args []string, nflags int) (cmd Command, rest []string, ok bool, err error) {
+	if len(args) == 0 {
+		if nflags > 0 {
+			return Command{}, nil, false, nil
+		}
+		def := strings.TrimSpace(os.Getenv("TSM_DEFAULT_COMMAND"))
+		if def == "" {
+			return Command{}, nil, false, nil
+		}
+		args = strings.Fields(def)
+	}
+	c, found := commands[args[0]]
+	if !found {
+		return Command{}, nil, false, fmt.Errorf("unknown command %q (available: %s)", args[0], strings.Join(commandNames(), ", "))
+	}
+	return c, args[1:], true, nil
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "which",
+		Summary: "Print the config file in use and where it was found",
+		Run: func(opts Options, _ []string) error {
+			path, source := locateConfigFile(opts.ConfigPath)
+			if path == "" {
+				fmt.Println("(no config file)")
+				return nil
+			}
+			fmt.Printf("%s\t(from %s)\n", path, source)
+			return nil
+		},
+	})
+}
+
+// confirm asks a yes/no question on stdin; anything but y/yes is "no".
+func confirm(prompt string) bool {
+	switch strings.ToLower(ask(prompt + " [y/N]")) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// stdinLines is shared by every prompt: a reader per prompt could buffer
+// lines typed ahead for the next one and lose them.
+var stdinLines = bufio.NewReader(os.Stdin)
+
+// ask prints prompt and returns the trimmed line typed on stdin.
+func ask(prompt string) string {
+	fmt.Printf("%s ", prompt)
+	line, _ := stdinLines.ReadString('\n')
+	return strings.TrimSpace(line)
+}
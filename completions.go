@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// ---------------- Shell completions ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "completions",
+		Summary: "Emit shell completions: completions generate [-static] [bash|zsh [-widget]]",
+		Run:     runCompletions,
+	})
+}
+
+var bashCompletionTmpl = template.Must(template.New("bash").Parse(`# bash completion for tsm — generated by ` + "`tsm completions generate`" + `
+# Load with: source <(tsm completions generate)
+{{- if .Dynamic}}
+
+# _tsm_sessions lists running sessions at completion time.
+_tsm_sessions() {
+    tsm -print 2>/dev/null | awk -F'\t' '$1 == "S" { print $2 }'
+}
+{{- end}}
+
+_tsm() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    if [[ $COMP_CWORD -eq 1 || "$cur" == -* ]]; then
+        COMPREPLY=( $(compgen -W "{{.Commands}} {{.Flags}}" -- "$cur") )
+        return
+    fi
+{{- if .Dynamic}}
+    case "${COMP_WORDS[1]}" in
+        {{.SessionCommands}})
+            COMPREPLY=( $(compgen -W "$(_tsm_sessions)" -- "$cur") )
+            return
+            ;;
+    esac
+{{- end}}
+    COMPREPLY=( $(compgen -f -- "$cur") )
+}
+complete -F _tsm tsm
+`))
+
+// zshWidget binds Ctrl-T to the picker and replaces the command line with
+// the selected path or session name.
+const zshWidget = `# zsh widget for tsm — generated by ` + "`tsm completions generate zsh -widget`" + `
+# Load with: source <(tsm completions generate zsh -widget)
+tsm-widget() {
+    local selected
+    selected="$(tsm -select </dev/tty)" || { zle reset-prompt; return }
+    BUFFER="${(q)selected}"
+    CURSOR=${#BUFFER}
+    zle reset-prompt
+}
+zle -N tsm-widget
+bindkey '^T' tsm-widget
+`
+
+// writeZshCompletion emits the bash script behind zsh's bashcompinit.
+func writeZshCompletion(w io.Writer, dynamic bool) error {
+	if _, err := io.WriteString(w, "autoload -U +X bashcompinit && bashcompinit\n"); err != nil {
+		return err
+	}
+	return writeBashCompletion(w, dynamic)
+}
+
+// writeBashCompletion renders the bash script. Dynamic scripts complete
+// session names for session-taking subcommands by asking tsm at runtime.
+func writeBashCompletion(w io.Writer, dynamic bool) error {
+	var cmds, sessCmds []string
+	for _, name := range commandNames() {
+		cmds = append(cmds, name)
+		if commands[name].SessionArgs {
+			sessCmds = append(sessCmds, name)
+		}
+	}
+	var flags []string
+	flag.CommandLine.VisitAll(func(f *flag.Flag) { flags = append(flags, "-"+f.Name) })
+	slices.Sort(flags)
+
+	return bashCompletionTmpl.Execute(w, struct {
+		Dynamic                          bool
+		Commands, Flags, SessionCommands string
+	}{
+		Dynamic:         dynamic && len(sessCmds) > 0,
+		Commands:        strings.Join(cmds, " "),
+		Flags:           strings.Join(flags, " "),
+		SessionCommands: strings.Join(sessCmds, "|"),
+	})
+}
+
+func runCompletions(_ Options, args []string) error {
+	if len(args) == 0 || args[0] != "generate" {
+		return errors.New("usage: tsm completions generate [-static] [bash|zsh [-widget]]")
+	}
+	fs := flag.NewFlagSet("completions generate", flag.ContinueOnError)
+	static := fs.Bool("static", false, "Omit runtime session-name completion")
+	widget := fs.Bool("widget", false, "zsh only: emit a Ctrl-T widget that inserts the picked path")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	sh := fs.Arg(0)
+	if fs.NArg() > 1 { // flags may also follow the shell name
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	switch {
+	case *widget && sh == "zsh":
+		_, err := io.WriteString(os.Stdout, zshWidget)
+		return err
+	case *widget:
+		return errors.New("-widget is only supported for zsh")
+	case sh == "" || sh == "bash":
+		return writeBashCompletion(os.Stdout, !*static)
+	case sh == "zsh":
+		return writeZshCompletion(os.Stdout, !*static)
+	default:
+		return fmt.Errorf("unsupported shell %q (supported: bash, zsh)", sh)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ---------------- config subcommands ----------------
+
+// configSubcommands are dispatched by `tsm config <name>`.
+var configSubcommands = map[string]Command{}
+
+func init() {
+	registerCommand(Command{
+		Name:    "config",
+		Summary: "Manage the config file: config lint|reset|update-schema",
+		Run:     runConfig,
+	})
+	configSubcommands["update-schema"] = Command{
+		Name:    "update-schema",
+		Summary: "Migrate the config file to the latest schema version",
+		Run:     runConfigUpdateSchema,
+	}
+	configSubcommands["reset"] = Command{
+		Name:    "reset",
+		Summary: "Delete the config file so the defaults apply again",
+		Run:     runConfigReset,
+	}
+}
+
+func runConfig(opts Options, args []string) error {
+	if len(args) == 0 {
+		names := slices.Sorted(maps.Keys(configSubcommands))
+		return fmt.Errorf("usage: tsm config <%s>", strings.Join(names, "|"))
+	}
+	sub, ok := configSubcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+	return sub.Run(opts, args[1:])
+}
+
+// ---------------- Schema migrations ----------------
+
+// configSchemaVersion is the `version:` written by this build of tsm.
+const configSchemaVersion = 1
+
+type migration struct {
+	Description string
+	Apply       func(root *yaml.Node)
+}
+
+// migrations[i] upgrades a version-i config to version i+1. The version key
+// itself is bumped by migrateConfig after each step.
+var migrations = []migration{
+	{Description: "record the schema version", Apply: func(*yaml.Node) {}},
+}
+
+// mappingValue returns the value node for key in a YAML mapping, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingScalar sets key to a scalar value, adding it first in the
+// mapping when it is missing.
+func setMappingScalar(m *yaml.Node, key, value, tag string) {
+	if v := mappingValue(m, key); v != nil {
+		v.Kind, v.Tag, v.Value, v.Content = yaml.ScalarNode, tag, value, nil
+		return
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	m.Content = append([]*yaml.Node{k, v}, m.Content...)
+}
+
+// appendMappingSequence appends string values to the sequence at key,
+// creating the key at the end of the mapping when it is missing or null.
+func appendMappingSequence(m *yaml.Node, key string, values []string) error {
+	seq := mappingValue(m, key)
+	switch {
+	case seq == nil:
+		seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, seq)
+	case seq.Kind == yaml.ScalarNode && seq.Tag == "!!null":
+		seq.Kind, seq.Tag, seq.Value = yaml.SequenceNode, "!!seq", ""
+	case seq.Kind != yaml.SequenceNode:
+		return fmt.Errorf("%s is not a list", key)
+	}
+	for _, v := range values {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v, Style: yaml.DoubleQuotedStyle})
+	}
+	return nil
+}
+
+// encodeYAML writes doc back out with the two-space indent tsm uses.
+func encodeYAML(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// migrateConfig upgrades YAML config data to configSchemaVersion, keeping
+// comments and key order. It returns the new document and the steps applied.
+func migrateConfig(data []byte) ([]byte, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if doc.Kind == 0 { // empty file
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, errors.New("config root is not a mapping")
+	}
+
+	from := 0
+	if v := mappingValue(root, "version"); v != nil {
+		n, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid version %q", v.Value)
+		}
+		from = n
+	}
+	if from > configSchemaVersion {
+		return nil, nil, fmt.Errorf("config version %d is newer than this tsm supports (%d)", from, configSchemaVersion)
+	}
+
+	var steps []string
+	for ver := from; ver < configSchemaVersion; ver++ {
+		migrations[ver].Apply(root)
+		setMappingScalar(root, "version", strconv.Itoa(ver+1), "!!int")
+		steps = append(steps, fmt.Sprintf("v%d → v%d: %s", ver, ver+1, migrations[ver].Description))
+	}
+	if len(steps) == 0 {
+		return data, nil, nil
+	}
+	out, err := encodeYAML(&doc)
+	return out, steps, err
+}
+
+func runConfigUpdateSchema(opts Options, args []string) error {
+	fs := flag.NewFlagSet("config update-schema", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Show the migrated config without writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := resolveConfigFile(opts.ConfigPath)
+	if path == "" {
+		return ErrConfigNotFound
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("only YAML configs can be migrated: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, steps, err := migrateConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(steps) == 0 {
+		fmt.Printf("%s is already at version %d\n", path, configSchemaVersion)
+		return nil
+	}
+	for _, s := range steps {
+		fmt.Println(s)
+	}
+	if *dryRun {
+		fmt.Printf("--- %s (not written) ---\n%s", path, out)
+		return nil
+	}
+
+	cfg, err := loadConfig(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	if _, err := backupConfig(path, cfg.MaxConfigBackups); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s to version %d\n", path, configSchemaVersion)
+	return nil
+}
+
+// ---------------- config reset ----------------
+
+func runConfigReset(opts Options, args []string) error {
+	fs := flag.NewFlagSet("config reset", flag.ContinueOnError)
+	backup := fs.Bool("backup", false, "Keep a timestamped backup of the config before deleting it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := resolveConfigFile(opts.ConfigPath)
+	if path == "" {
+		return ErrConfigNotFound
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrConfigNotFound, path)
+		}
+		return err
+	}
+	keep := 0
+	if *backup {
+		// best-effort: a config broken enough to reset may not load, and
+		// keep 0 then just skips pruning
+		cfg, _ := loadConfig(opts.ConfigPath)
+		keep = cfg.MaxConfigBackups
+	}
+	return resetConfig(path, *backup, keep, confirm)
+}
+
+// resetConfig removes path once ok approves. With backup it first copies it
+// into the backups dir like backup-config, keeping at most keep copies.
+func resetConfig(path string, backup bool, keep int, ok func(prompt string) bool) error {
+	prompt := "Delete " + path + " and use the defaults?"
+	if backup {
+		prompt = "Back up and delete " + path + " and use the defaults?"
+	}
+	if !ok(prompt) {
+		return ErrCancelled
+	}
+	if backup {
+		dst, err := backupConfig(path, keep)
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		fmt.Printf("Backed up %s → %s\n", path, dst)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s\n", path)
+	return nil
+}
+
+// ---------------- edit-config ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "edit-config",
+		Summary: "Open the config file in $EDITOR and validate it afterwards",
+		Run:     runEditConfig,
+	})
+}
+
+// editorCommand returns $EDITOR, else $VISUAL, else vi, split into words.
+func editorCommand() ([]string, error) {
+	for _, env := range []string{"EDITOR", "VISUAL"} {
+		if e := strings.TrimSpace(os.Getenv(env)); e != "" {
+			words, err := splitShellWords(e)
+			if err != nil {
+				return nil, fmt.Errorf("$%s: %w", env, err)
+			}
+			return words, nil
+		}
+	}
+	return []string{"vi"}, nil
+}
+
+func runEditConfig(opts Options, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: tsm edit-config")
+	}
+	path := opts.ConfigPath
+	if path == "" {
+		var err error
+		if path, err = xdgConfigPath(); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := writeDefaultConfigAs(os.Stdout, path); err != nil {
+			return err
+		}
+	}
+	editor, err := editorCommand()
+	if err != nil {
+		return err
+	}
+	// no timeout: the editor runs for as long as the user needs
+	if err := shell.Run(context.Background(), editor[0], append(editor[1:], path)...); err != nil {
+		return fmt.Errorf("%s: %w", editor[0], err)
+	}
+	if _, err := loadConfig(path); err != nil {
+		return fmt.Errorf("%s is invalid: %w", path, err)
+	}
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
+
+// ---------------- Bookmark rename ----------------
+
+// replaceSequenceValue replaces every scalar equal to old in the sequence
+// under key with name, reporting how many were changed.
+func replaceSequenceValue(m *yaml.Node, key, old, name string) int {
+	seq := mappingValue(m, key)
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return 0
+	}
+	n := 0
+	for _, item := range seq.Content {
+		if item.Kind == yaml.ScalarNode && item.Value == old {
+			item.Value = name
+			n++
+		}
+	}
+	return n
+}
+
+// renameBookmark rewrites bookmarks equal to old in the YAML config to name.
+// Configs without such a bookmark are left untouched.
+func renameBookmark(explicit, old, name string) error {
+	cfg, err := loadConfig(explicit)
+	if err != nil || !slices.Contains(cfg.Bookmarks, old) {
+		return err
+	}
+	path := resolveConfigFile(explicit)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("only YAML configs can be updated; rename bookmark %q by hand in %s", old, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if doc.Kind == 0 || doc.Content[0].Kind != yaml.MappingNode ||
+		replaceSequenceValue(doc.Content[0], "bookmarks", old, name) == 0 {
+		return nil // e.g. bookmarks reached through an alias
+	}
+	out, err := encodeYAML(&doc)
+	if err != nil {
+		return err
+	}
+	if _, err := backupConfig(path, cfg.MaxConfigBackups); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Updated bookmark %s -> %s in %s\n", old, name, path)
+	return nil
+}
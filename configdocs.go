@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ---------------- Config documentation ----------------
+
+type configDoc struct {
+	Type        string
+	Default     string // YAML value
+	Description string
+}
+
+// configDocs documents every supported config key. It is the source for
+// config.example.yaml; keep it in sync with Config.
+var configDocs = map[string]configDoc{
+	"version": {
+		Type:        "int",
+		Default:     strconv.Itoa(configSchemaVersion),
+		Description: "Config schema version; `tsm config update-schema` migrates older files.",
+	},
+	"scan_paths": {
+		Type:        "list of paths",
+		Default:     `["$HOME/Code"]`,
+		Description: "Roots scanned for git repositories ($VARS and ~ are expanded).",
+	},
+	"bookmarks": {
+		Type:        "list of paths",
+		Default:     `[]`,
+		Description: "Directories always shown in the picker.",
+	},
+	"exclude_dirs": {
+		Type:        "list of names",
+		Default:     "[" + strings.Join(quoteAll(defaultExclude()), ", ") + "]",
+		Description: "Directory names skipped while scanning; entries with *, ? or [...] are glob patterns matched against the name, e.g. \"*.bak\" or \"tmp_*\".",
+	},
+	"max_depth": {
+		Type:        "int",
+		Default:     "3",
+		Description: "How many levels below each scan path to descend.",
+	},
+	"disable_git_checks": {
+		Type:        "bool",
+		Default:     "false",
+		Description: "Never run the git binary; repos are found by directory markers only.",
+	},
+	"split_preview": {
+		Type:        "bool",
+		Default:     "false",
+		Description: "Show the preview in the right half of the picker at all times (Tab hides it).",
+	},
+	"follow_symlinks": {
+		Type:        "bool",
+		Default:     "false",
+		Description: "Descend into symlinked directories while scanning (loops are detected).",
+	},
+	"scan_ssh_config": {
+		Type:        "bool",
+		Default:     "false",
+		Description: "List the Host entries of ~/.ssh/config (without wildcards) as ssh_<host> bookmarks whose sessions open `ssh <host>`.",
+	},
+	"cache_ttl": {
+		Type:        "duration",
+		Default:     `"5m"`,
+		Description: "How long scan results cached in $XDG_CACHE_HOME/tsm/repos.json are reused for unchanged directories; 0 disables the cache.",
+	},
+	"project_markers": {
+		Type:        "list of names",
+		Default:     `[".git"]`,
+		Description: "Files or directories marking a project root, e.g. [\".git\", \"go.mod\", \"package.json\"]; non-git roots are listed as P.",
+	},
+	"max_scan_concurrency": {
+		Type:        "int",
+		Default:     "0",
+		Description: "How many scan paths are walked in parallel; 0 uses the number of CPUs. Lower it for network mounts.",
+	},
+	"timeout": {
+		Type:        "duration",
+		Default:     `"0s"`,
+		Description: "Time limit for the tmux and git calls of one tsm run, e.g. \"30s\" on slow NFS mounts; 0 keeps the built-in 6s. -timeout overrides it.",
+	},
+	"session_idle_timeout": {
+		Type:        "duration",
+		Default:     `"0s"`,
+		Description: "Before showing the picker, kill detached sessions last attached (or, if never attached, created) longer ago than this, e.g. \"2h\"; 0 keeps every session.",
+	},
+	"max_results": {
+		Type:        "int",
+		Default:     "30",
+		Description: "Most candidates the picker lists; it also never lists more than the terminal height allows. -max overrides it.",
+	},
+	"max_config_backups": {
+		Type:        "int",
+		Default:     "10",
+		Description: "Number of config backups kept under backups/.",
+	},
+	"name_template": {
+		Type:        "string",
+		Default:     `""`,
+		Description: "Go template for session names from .Root, .Parent, .Base and .Depth, e.g. \"{{.Base}}\"; empty means \"{{.Parent}}_{{.Base}}\".",
+	},
+	"session_name_max_len": {
+		Type:        "int",
+		Default:     "0",
+		Description: "Shorten derived session names longer than this to that many characters ending in \"_\", e.g. 24 for a narrow status-left; 0 keeps names whole.",
+	},
+	"collision_strategy": {
+		Type:        "string",
+		Default:     `"first"`,
+		Description: "What to do when directories at different paths derive the same session name: first (list every path, silently), warn (the same, logging each collision to stderr) or disambiguate (give all but one path the name <name>-<hash of the path>).",
+	},
+	"hooks": {
+		Type:        "map with pre_create and post_create lists",
+		Default:     `{pre_create: [], post_create: []}`,
+		Description: "Shell commands run before and after tsm creates a session, with TSM_SESSION and TSM_DIR set; a failing pre_create command aborts the creation, post_create failures are logged.",
+	},
+	"theme": {
+		Type:        "map of session_color, repo_color, bookmark_color and selected_bg",
+		Default:     `{}`,
+		Description: "Picker colours layered over -color-scheme, as SGR codes (\"36\", \"1;7\") or names (cyan, bright-green, ...); a selected_bg name is a background colour. Colours are off for $NO_COLOR or when stdout is not a terminal.",
+	},
+	"fuzzy_mode": {
+		Type:        "string",
+		Default:     `"subsequence"`,
+		Description: "How picker queries match: subsequence (characters in order, gaps allowed), exact (substring) or prefix (name starts with the query).",
+	},
+	"case_sensitive": {
+		Type:        "bool",
+		Default:     "false",
+		Description: "Match picker queries case-sensitively.",
+	},
+	"layouts": {
+		Type:        "map of path glob to layout name",
+		Default:     `{}`,
+		Description: "New sessions whose directory matches a glob (e.g. \"*/api-*\") get the windows of that layout_definitions entry; globs match case-insensitively.",
+	},
+	"groups": {
+		Type:        "map of label to list of path globs",
+		Default:     `{}`,
+		Description: "Labels for items whose path matches a glob, e.g. {work: [\"~/Code/company/*\"]}; Ctrl-G in the picker cycles through them and -group <label> keeps only that label's items.",
+	},
+	"layout_definitions": {
+		Type:        "map of layout name to list of windows",
+		Default:     `{}`,
+		Description: "Named lists of extra windows, each with name, dir (relative to the session directory) and cmd.",
+	},
+	"tmux_switch_flags": {
+		Type:        "list of strings",
+		Default:     `[]`,
+		Description: "Extra flags for `tmux switch-client` when tsm runs inside tmux (e.g. [\"-E\"]).",
+	},
+	"tmux_attach_flags": {
+		Type:        "list of strings",
+		Default:     `[]`,
+		Description: "Extra flags for `tmux attach` when tsm runs outside tmux (e.g. [\"-d\"]).",
+	},
+}
+
+func quoteAll(ss []string) []string {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = fmt.Sprintf("%q", s)
+	}
+	return out
+}
+
+// exampleConfig renders configDocs as a commented YAML file where every key
+// is set to its default.
+func exampleConfig() []byte {
+	keys := make([]string, 0, len(configDocs))
+	for k := range configDocs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("# tsm config reference — documentation only, never loaded.\n")
+	buf.WriteString("# Copy the keys you need into config.yaml.\n")
+	for _, k := range keys {
+		d := configDocs[k]
+		fmt.Fprintf(&buf, "\n# %s\n# type: %s, default: %s\n%s: %s\n", d.Description, d.Type, d.Default, k, d.Default)
+	}
+	return buf.Bytes()
+}
+
+// writeExampleConfig writes config.example.yaml next to the XDG config,
+// replacing any previous copy.
+func writeExampleConfig(w io.Writer) error {
+	path, err := xdgConfigPath()
+	if err != nil {
+		return err
+	}
+	path = filepath.Join(filepath.Dir(path), "config.example.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, exampleConfig(), 0o644); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "Wrote example config → %s\n", path)
+	return nil
+}
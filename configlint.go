@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ---------------- config lint ----------------
+
+// configMinimums are lower bounds for numeric config keys.
+var configMinimums = map[string]float64{
+	"version":              0,
+	"max_depth":            0,
+	"max_config_backups":   0,
+	"max_scan_concurrency": 0,
+	"max_results":          0,
+	"session_name_max_len": 0,
+}
+
+func init() {
+	configSubcommands["lint"] = Command{
+		Name:    "lint",
+		Summary: "Validate the config file against the JSON Schema of Config",
+		Run:     runConfigLint,
+	}
+}
+
+// configJSONSchema derives a JSON Schema (draft 2020-12) for the config file
+// from the mapstructure tags on Config.
+func configJSONSchema() map[string]any {
+	props := map[string]any{}
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		key := f.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		p := jsonSchemaType(f.Type)
+		if d, ok := configDocs[key]; ok {
+			p["description"] = d.Description
+		}
+		if m, ok := configMinimums[key]; ok {
+			p["minimum"] = m
+		}
+		props[key] = p
+	}
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                appName + " config",
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+func jsonSchemaType(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[time.Duration]():
+		return map[string]any{"type": "string"} // e.g. "5m"
+	case reflect.TypeFor[ColorSpec]():
+		return map[string]any{"type": []string{"string", "integer"}} // "cyan" or 36
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": jsonSchemaType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchemaType(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		for i := range t.NumField() {
+			if key := t.Field(i).Tag.Get("mapstructure"); key != "" && key != "-" {
+				props[key] = jsonSchemaType(t.Field(i).Type)
+			}
+		}
+		return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// lintConfig checks settings against schema. Violations are errors; keys
+// the schema doesn't know are only warnings.
+func lintConfig(settings map[string]any, schema map[string]any) (errs, warnings []string) {
+	props := schema["properties"].(map[string]any)
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		p, ok := props[key].(map[string]any)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("unknown key %q", key))
+			continue
+		}
+		if msg := checkSchemaValue(settings[key], p); msg != "" {
+			errs = append(errs, key+": "+msg)
+		}
+	}
+	return errs, warnings
+}
+
+// checkSchemaValue returns a description of why v violates p, or "".
+// A null value means "use the default" and always passes.
+func checkSchemaValue(v any, p map[string]any) string {
+	if v == nil {
+		return ""
+	}
+	if types, ok := p["type"].([]string); ok {
+		for _, typ := range types {
+			alt := maps.Clone(p)
+			alt["type"] = typ
+			if checkSchemaValue(v, alt) == "" {
+				return ""
+			}
+		}
+		return fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), describeValue(v))
+	}
+	want, _ := p["type"].(string)
+	switch want {
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Sprintf("expected boolean, got %s", describeValue(v))
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Sprintf("expected string, got %s", describeValue(v))
+		}
+	case "integer":
+		n, ok := asNumber(v)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Sprintf("expected integer, got %s", describeValue(v))
+		}
+		if m, ok := p["minimum"].(float64); ok && n < m {
+			return fmt.Sprintf("must be >= %g, got %g", m, n)
+		}
+	case "array":
+		list, ok := v.([]any)
+		if !ok {
+			return fmt.Sprintf("expected array, got %s", describeValue(v))
+		}
+		items, _ := p["items"].(map[string]any)
+		for i, el := range list {
+			if msg := checkSchemaValue(el, items); msg != "" {
+				return fmt.Sprintf("item %d: %s", i, msg)
+			}
+		}
+	case "object":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Sprintf("expected mapping, got %s", describeValue(v))
+		}
+		props, _ := p["properties"].(map[string]any)
+		extra, _ := p["additionalProperties"].(map[string]any)
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			sub, ok := props[key].(map[string]any)
+			if !ok {
+				sub = extra
+			}
+			if sub == nil {
+				return fmt.Sprintf("unknown key %q", key)
+			}
+			if msg := checkSchemaValue(m[key], sub); msg != "" {
+				return key + ": " + msg
+			}
+		}
+	}
+	return ""
+}
+
+func asNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func describeValue(v any) string {
+	switch v.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	if _, ok := asNumber(v); ok {
+		return fmt.Sprintf("number %v", v)
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func runConfigLint(opts Options, args []string) error {
+	fs := flag.NewFlagSet("config lint", flag.ContinueOnError)
+	printSchema := fs.Bool("schema", false, "Print the JSON Schema instead of linting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	schema := configJSONSchema()
+	if *printSchema {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schema)
+	}
+
+	path := resolveConfigFile(opts.ConfigPath)
+	if path == "" {
+		return ErrConfigNotFound
+	}
+	return lintConfigFile(path)
+}
+
+// lintConfigFile reads path, prints its warnings and violations, and fails
+// when there is at least one violation.
+func lintConfigFile(path string) error {
+	v := viper.New()
+	if err := readConfigFile(v, path); err != nil {
+		return err
+	}
+	errs, warnings := lintConfig(v.AllSettings(), configJSONSchema())
+	for _, w := range warnings {
+		fmt.Printf("%s: warning: %s\n", path, w)
+	}
+	for _, e := range errs {
+		fmt.Printf("%s: error: %s\n", path, e)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %d schema violation(s)", path, len(errs))
+	}
+	if len(warnings) == 0 {
+		fmt.Printf("%s: ok\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// ---------------- Diagnostics ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "debug-fuzzy",
+		Summary: "Show how every item scores for a query: debug-fuzzy <query>",
+		Run:     runDebugFuzzy,
+	})
+}
+
+type fuzzyRow struct {
+	Item
+	detail  fuzzyDetail
+	matched bool
+}
+
+// fuzzyRows scores every item against q: matches first by descending total
+// (ties by name, as in filterAndRank), then non-matching items by name.
+func fuzzyRows(items []Item, q string, m MatchOptions) []fuzzyRow {
+	rows := make([]fuzzyRow, 0, len(items))
+	for _, it := range items {
+		d, ok := fuzzyScoreDetail(q, matchKey(it), m)
+		rows = append(rows, fuzzyRow{Item: it, detail: d, matched: ok})
+	}
+	slices.SortFunc(rows, func(a, b fuzzyRow) int {
+		if a.matched != b.matched {
+			if a.matched {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(b.detail.total(), a.detail.total()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return rows
+}
+
+func runDebugFuzzy(opts Options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tsm debug-fuzzy <query>")
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	match, err := cfg.matchOptions()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCORE\tBASE\tSTREAK\tPREFIX\tKIND\tNAME\tPATH")
+	for _, r := range fuzzyRows(buildItems(ctx, cfg), args[0], match) {
+		if !r.matched {
+			fmt.Fprintf(tw, "-\t-\t-\t-\t%s\t%s\t%s\n", r.Kind, r.Name, r.Path)
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			r.detail.total(), r.detail.Base, r.detail.Streak, r.detail.Prefix, r.Kind, r.Name, r.Path)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "debug-config",
+		Summary: "Trace how the effective config is put together, step by step",
+		Run:     runDebugConfig,
+	})
+}
+
+// configValues maps cfg's fields to plain values for printing, keyed by
+// config key; flag-only fields use their Go name.
+func configValues(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Struct:
+		m := map[string]any{}
+		for i := range v.NumField() {
+			f := v.Type().Field(i)
+			key := f.Tag.Get("mapstructure")
+			if key == "" || key == "-" {
+				key = f.Name
+			}
+			m[key] = configValues(v.Field(i))
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return []any{}
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = configValues(v.Index(i))
+		}
+		return list
+	case reflect.Map:
+		m := map[string]any{}
+		for _, k := range v.MapKeys() {
+			m[k.String()] = configValues(v.MapIndex(k))
+		}
+		return m
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return v.Interface()
+}
+
+// changedValues returns the top-level entries of after that differ from
+// before.
+func changedValues(before, after map[string]any) map[string]any {
+	out := map[string]any{}
+	for k, v := range after {
+		if !reflect.DeepEqual(before[k], v) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// traceConfig writes each step of config resolution for opts to w.
+func traceConfig(w io.Writer, opts Options) error {
+	step := 0
+	show := func(title string, value any) {
+		step++
+		fmt.Fprintf(w, "%d. %s\n", step, title)
+		if value == nil {
+			return
+		}
+		var buf strings.Builder
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(value); err != nil {
+			buf.WriteString(err.Error() + "\n")
+		}
+		for line := range strings.Lines(buf.String()) {
+			fmt.Fprint(w, "   ", line)
+		}
+	}
+
+	var defaults Config
+	applyConfigDefaults(&defaults, viper.New())
+	show("Defaults", configValues(reflect.ValueOf(defaults)))
+
+	v := viper.New()
+	path, source := locateConfigFile(opts.ConfigPath)
+	switch {
+	case path == "":
+		show("Config file: none found (from "+source+"); defaults apply", nil)
+	default:
+		if err := readConfigFile(v, path); err != nil {
+			show(fmt.Sprintf("Config file: %s (from %s) failed: %v", path, source, err), nil)
+		} else {
+			show(fmt.Sprintf("Config file: %s (from %s) loaded", path, source), v.AllSettings())
+		}
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		show("Unmarshal failed: "+err.Error(), nil)
+	}
+	applyConfigDefaults(&cfg, v)
+	loaded := configValues(reflect.ValueOf(cfg)).(map[string]any)
+	show("Unmarshalled, defaults filled in", loaded)
+
+	env := map[string]string{}
+	for _, k := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", "TSM_LOG_LEVEL", "TSM_DEFAULT_COMMAND", "NO_COLOR"} {
+		if val, ok := os.LookupEnv(k); ok {
+			env[k] = val
+		}
+	}
+	show("Environment (config keys are not read from it; these only affect paths and logging)", env)
+
+	opts.apply(&cfg)
+	final := configValues(reflect.ValueOf(cfg)).(map[string]any)
+	show("Command-line overrides", changedValues(loaded, final))
+	show("Final config", final)
+	return nil
+}
+
+func runDebugConfig(opts Options, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: tsm debug-config")
+	}
+	return traceConfig(os.Stdout, opts)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ---------------- Dry run ----------------
+
+// dryRunShell prints the commands tsm would run instead of running them
+// (set from -dry-run). Output and the queries isDryRunQuery recognises
+// still reach the real shell, so decisions such as "does the session
+// exist?" are made as they would be for real.
+type dryRunShell struct {
+	inner Shell
+	w     io.Writer
+}
+
+// isDryRunQuery reports whether a Shell.Run command only inspects state;
+// its exit status steers what tsm does next.
+func isDryRunQuery(name string, args []string) bool {
+	switch name {
+	case "tmux":
+		return slices.Contains(args, "has-session")
+	}
+	return false
+}
+
+// shellJoin renders a command line, quoting the words that need it.
+func shellJoin(name string, args []string) string {
+	words := make([]string, 0, 1+len(args))
+	for _, a := range append([]string{name}, args...) {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`*?[]#~;&|<>(){}!") {
+			a = shellQuote(a)
+		}
+		words = append(words, a)
+	}
+	return strings.Join(words, " ")
+}
+
+func (d dryRunShell) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return d.inner.Output(ctx, name, args...)
+}
+
+func (d dryRunShell) Run(ctx context.Context, name string, args ...string) error {
+	if isDryRunQuery(name, args) {
+		return d.inner.Run(ctx, name, args...)
+	}
+	_, _ = fmt.Fprintln(d.w, "+ "+shellJoin(name, args))
+	return nil
+}
+
+func (d dryRunShell) IsAvailable(name string) bool { return d.inner.IsAvailable(name) }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ---------------- ensure ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "ensure",
+		Summary: "Create sessions for the given directories without switching: ensure <path>...",
+		Run:     runEnsure,
+	})
+}
+
+// ensurePaths makes sure a session exists for every path and writes one
+// status line per path to w. Each path gets its own timeout. It returns the
+// number of paths that failed.
+func ensurePaths(timeout time.Duration, cfg Config, w io.Writer, paths []string) int {
+	failed := 0
+	for _, p := range paths {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		status, err := ensurePath(ctx, cfg, p)
+		cancel()
+		if err != nil {
+			failed++
+			status = "error: " + err.Error()
+		}
+		fmt.Fprintf(w, "%s: %s\n", p, status)
+	}
+	return failed
+}
+
+func ensurePath(ctx context.Context, cfg Config, p string) (string, error) {
+	dir, ok := expandPath(p)
+	if !ok {
+		return "", errors.New("cannot expand path")
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", errors.New("not a directory")
+	}
+	_, created, err := createSessionForDir(ctx, cfg, sessionNameForDir(ctx, cfg, dir), dir)
+	switch {
+	case err != nil:
+		return "", err
+	case created:
+		return "created", nil
+	default:
+		return "exists", nil
+	}
+}
+
+func runEnsure(opts Options, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: tsm ensure <path>...")
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+	if n := ensurePaths(opts.timeout(), cfg, os.Stdout, args); n > 0 {
+		return fmt.Errorf("%d of %d paths failed", n, len(args))
+	}
+	return nil
+}
+
+// ---------------- new ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "new",
+		Summary: "Create or switch to the session for a directory: new [-name NAME] <path>",
+		Run:     runNew,
+	})
+}
+
+func runNew(opts Options, args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	name := fs.String("name", "", "Session name (default: derived from the path)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tsm new [-name NAME] <path>")
+	}
+	dir, ok := expandPath(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("cannot resolve path %q", fs.Arg(0))
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	sess := sessionNameForDir(ctx, cfg, dir)
+	if *name != "" {
+		sess = sanitize(*name)
+	}
+	sess, err = createOrSwitchForDir(ctx, cfg, sess, dir, isInTmux())
+	if err != nil {
+		return err
+	}
+	_ = appendHistory(Item{Kind: KindBookmark, Name: sess, Path: dir})
+	fmt.Println(sess)
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ---------------- Errors ----------------
+
+// Sentinel errors wrapped by tsm so callers can branch with errors.Is.
+var (
+	ErrNoTmux         = errors.New("tmux not available")
+	ErrNoSession      = errors.New("no such session")
+	ErrSessionExists  = errors.New("session already exists")
+	ErrConfigNotFound = errors.New("config file not found")
+	ErrConfigExists   = errors.New("config already exists")
+	ErrScanFailed     = errors.New("scan failed")
+	ErrCancelled      = errors.New("cancelled")
+)
+
+// exitStatus is returned by commands that report their result through the
+// exit code alone; main exits with it without logging anything.
+type exitStatus int
+
+func (s exitStatus) Error() string { return fmt.Sprintf("exit status %d", int(s)) }
+
+// errorHint returns a short, actionable suggestion for well-known errors.
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, ErrNoTmux):
+		return "is tmux installed and on $PATH? try `tmux new-session` first"
+	case errors.Is(err, ErrNoSession):
+		return "list running sessions with `tmux ls`"
+	case errors.Is(err, ErrSessionExists):
+		return "pick another name or switch to the existing session"
+	case errors.Is(err, ErrConfigNotFound):
+		return "create one with `tsm -init-config` or fix the -config path"
+	case errors.Is(err, ErrScanFailed):
+		return "check that scan_paths exist and are readable"
+	}
+	return ""
+}
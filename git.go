@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ---------------- git ----------------
+
+// gitParallelism bounds concurrent git processes.
+const gitParallelism = 8
+
+// requireGit fails when cfg forbids running git or git is not installed.
+func requireGit(cfg Config, feature string) error {
+	if cfg.DisableGitChecks {
+		return fmt.Errorf("%s needs git, but git checks are disabled (-no-git / disable_git_checks)", feature)
+	}
+	if !shell.IsAvailable("git") {
+		return errors.New(feature + " needs git, which is not in PATH")
+	}
+	return nil
+}
+
+// gitClean reports whether the work tree at dir has no uncommitted changes.
+func gitClean(ctx context.Context, dir string) (bool, error) {
+	out, err := shell.Output(ctx, "git", "-C", dir, "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	return len(bytes.TrimSpace(out)) == 0, nil
+}
+
+// cleanRepos keeps the repos and worktrees in items whose work tree is
+// clean, checking them concurrently. Order is preserved; repos git cannot
+// inspect are dropped.
+func cleanRepos(ctx context.Context, items []Item) []Item {
+	keep := make([]bool, len(items))
+	sem := make(chan struct{}, gitParallelism)
+	var wg sync.WaitGroup
+	for i, it := range items {
+		if it.Kind != KindGitRepo && it.Kind != KindWorktree {
+			continue
+		}
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			keep[i], _ = gitClean(ctx, it.Path)
+		})
+	}
+	wg.Wait()
+	var out []Item
+	for i, it := range items {
+		if keep[i] {
+			out = append(out, it)
+		}
+	}
+	return out
+}
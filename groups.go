@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ---------------- Groups ----------------
+
+// groupGlobs is one group label with its compiled path globs.
+type groupGlobs struct {
+	Label string
+	Globs []*regexp.Regexp
+}
+
+// expandGlob expands $VARS and a leading ~ in a path glob.
+func expandGlob(glob string) string {
+	glob = os.ExpandEnv(glob)
+	if rest, ok := strings.CutPrefix(glob, "~"); ok {
+		if home, _ := os.UserHomeDir(); home != "" {
+			glob = filepath.Join(home, rest)
+		}
+	}
+	return filepath.ToSlash(glob)
+}
+
+// compileGroups compiles the globs of cfg.Groups, ordered by label.
+func compileGroups(groups map[string][]string) ([]groupGlobs, error) {
+	var out []groupGlobs
+	for _, label := range slices.Sorted(maps.Keys(groups)) {
+		g := groupGlobs{Label: label}
+		for _, glob := range groups[label] {
+			re, err := globRegexp(expandGlob(glob))
+			if err != nil {
+				return nil, fmt.Errorf("groups: %s: %w", label, err)
+			}
+			g.Globs = append(g.Globs, re)
+		}
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+// assignGroups sets the Group of each item whose path matches a group glob
+// to that group's label, the first label in order when several match.
+func assignGroups(items []Item, groups []groupGlobs) {
+	for i, it := range items {
+		if it.Path == "" {
+			continue
+		}
+		p := filepath.ToSlash(it.Path)
+		for _, g := range groups {
+			if slices.ContainsFunc(g.Globs, func(re *regexp.Regexp) bool { return re.MatchString(p) }) {
+				items[i].Group = g.Label
+				break
+			}
+		}
+	}
+}
+
+// filterByGroup keeps the items in group; an empty group keeps all.
+func filterByGroup(items []Item, group string) []Item {
+	if group == "" {
+		return items
+	}
+	var out []Item
+	for _, it := range items {
+		if it.Group == group {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// nextGroup returns the group after cur in labels, cycling back to "" (all
+// items) after the last.
+func nextGroup(labels []string, cur string) string {
+	i := slices.Index(labels, cur)
+	if i+1 >= len(labels) {
+		return ""
+	}
+	return labels[i+1]
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ---------------- Access history ----------------
+
+// HistoryEntry records one session switch or creation.
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	Kind ItemKind  `json:"kind"`
+	Name string    `json:"name"`
+	Path string    `json:"path,omitempty"`
+}
+
+func historyPath() (string, error) {
+	dir, err := xdgDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// appendHistory adds it to the history file (JSON lines, oldest first).
+func appendHistory(it Item) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(HistoryEntry{Time: time.Now(), Kind: it.Kind, Name: it.Name, Path: it.Path})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHistory returns all entries, oldest first. Unparseable lines are
+// skipped; a missing file yields no entries.
+func loadHistory() ([]HistoryEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var res []HistoryEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.Name != "" {
+			res = append(res, e)
+		}
+	}
+	return res, sc.Err()
+}
+
+// renameHistory rewrites the names of renamed sessions in the history file,
+// applying the renames in order.
+func renameHistory(renames []sessionRename) error {
+	if len(renames) == 0 {
+		return nil
+	}
+	hist, err := loadHistory()
+	if err != nil || len(hist) == 0 {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, e := range hist {
+		for _, r := range renames {
+			if e.Name == r.Old {
+				e.Name = r.New
+			}
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recentSessionNames returns distinct session names from history,
+// most recent first.
+func recentSessionNames() []string {
+	hist, _ := loadHistory() // best-effort
+	seen := map[string]struct{}{}
+	var names []string
+	for _, e := range slices.Backward(hist) {
+		if _, ok := seen[e.Name]; ok {
+			continue
+		}
+		seen[e.Name] = struct{}{}
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// recentItems returns up to n distinct items from hist, most recent first.
+// Running sessions stay sessions; other entries are offered again only if
+// their directory still exists.
+func recentItems(hist []HistoryEntry, sessions []string, n int) []Item {
+	running := map[string]bool{}
+	for _, s := range sessions {
+		running[s] = true
+	}
+	seen := map[string]struct{}{}
+	var items []Item
+	for _, e := range slices.Backward(hist) {
+		if len(items) == n {
+			break
+		}
+		if _, ok := seen[e.Name]; ok {
+			continue
+		}
+		seen[e.Name] = struct{}{}
+		switch {
+		case running[e.Name]:
+			items = append(items, Item{Kind: KindSession, Name: e.Name, Path: e.Path})
+		case e.Path != "" && isDir(e.Path):
+			kind := e.Kind
+			if kind == KindSession {
+				kind = KindBookmark
+			}
+			items = append(items, Item{Kind: kind, Name: e.Name, Path: e.Path})
+		}
+	}
+	return items
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "reattach",
+		Summary: "Switch to the most recently used session without the picker",
+		Run:     runReattach,
+	})
+}
+
+func runReattach(opts Options, args []string) error {
+	fs := flag.NewFlagSet("reattach", flag.ContinueOnError)
+	name := fs.String("session", "", "Reattach to this session instead of the last used one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+
+	target := *name
+	if target != "" && !hasSession(ctx, target) {
+		return fmt.Errorf("%w: %s", ErrNoSession, target)
+	}
+	if target == "" {
+		for _, n := range recentSessionNames() {
+			if hasSession(ctx, n) {
+				target = n
+				break
+			}
+		}
+	}
+	if target == "" {
+		sessions := listTmuxSessions(ctx)
+		if len(sessions) == 0 {
+			return fmt.Errorf("%w: no tmux sessions running", ErrNoSession)
+		}
+		target = sessions[0]
+	}
+	if err := switchToSession(ctx, cfg, target, isInTmux()); err != nil {
+		return err
+	}
+	_ = appendHistory(Item{Kind: KindSession, Name: target})
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "history",
+		Summary: "Show the access history: history [-limit N] [-since DATE] [-kind S|G|B|W|P] [-json]",
+		Run:     runHistory,
+	})
+}
+
+// historyTimeLayout formats entry times in `tsm history`.
+const historyTimeLayout = time.DateTime
+
+// parseSince parses a -since value: a date, a date and time, RFC 3339, or
+// a duration such as "3d" meaning that long before now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, time.DateTime, time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if d, err := parseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q (want 2006-01-02, \"2006-01-02 15:04:05\" or a duration such as 3d)", s)
+}
+
+// filterHistory keeps the entries at or after since (when set) of kind
+// (when set), then the last limit of those (when limit > 0).
+func filterHistory(hist []HistoryEntry, limit int, since time.Time, kind ItemKind) []HistoryEntry {
+	var out []HistoryEntry
+	for _, e := range hist {
+		if (since.IsZero() || !e.Time.Before(since)) && (kind == "" || e.Kind == kind) {
+			out = append(out, e)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// writeHistory prints entries as aligned text or, with asJSON, as a JSON
+// array.
+func writeHistory(w io.Writer, entries []HistoryEntry, asJSON bool) error {
+	if asJSON {
+		if entries == nil {
+			entries = []HistoryEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Time.Local().Format(historyTimeLayout), e.Kind, e.Name, e.Path)
+	}
+	return tw.Flush()
+}
+
+func runHistory(_ Options, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "Only show the last N entries")
+	since := fs.String("since", "", "Only show entries from this date (2006-01-02) or duration ago (3d) on")
+	kind := fs.String("kind", "", "Only show entries of this kind: S, G, B, W or P")
+	asJSON := fs.Bool("json", false, "Print a JSON array of {time, kind, name, path}")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *limit < 0 {
+		return errors.New("usage: tsm history [-limit N] [-since DATE] [-kind S|G|B|W|P] [-json]")
+	}
+	switch k := ItemKind(strings.ToUpper(*kind)); k {
+	case "", KindSession, KindGitRepo, KindBookmark, KindWorktree, KindProject:
+		*kind = string(k)
+	default:
+		return fmt.Errorf("invalid -kind %q (want S, G, B, W or P)", *kind)
+	}
+	var from time.Time
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		from = t
+	}
+	hist, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	entries := filterHistory(hist, *limit, from, ItemKind(*kind))
+
+	// page plain-text listings taller than the terminal, like git log
+	fi, err := os.Stdout.Stat()
+	if *asJSON || err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return writeHistory(os.Stdout, entries, *asJSON)
+	}
+	if rows, _ := termSize(); rows == 0 || len(entries) < rows {
+		return writeHistory(os.Stdout, entries, false)
+	}
+	var b strings.Builder
+	if err := writeHistory(&b, entries, false); err != nil {
+		return err
+	}
+	return pageText(b.String())
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// ---------------- Hooks ----------------
+
+// Hooks are shell commands run around session creation, with TSM_SESSION
+// and TSM_DIR set to the session name and directory.
+type Hooks struct {
+	PreCreate  []string `mapstructure:"pre_create"`  // a failure aborts the creation
+	PostCreate []string `mapstructure:"post_create"` // failures are logged
+}
+
+// hookSpec describes one configurable hook for list-hooks.
+type hookSpec struct {
+	Key      string
+	Trigger  string
+	Commands func(Config) []string
+}
+
+// hookSpecs lists every hook in the order tsm fires them.
+var hookSpecs = []hookSpec{
+	{
+		Key:      "hooks.pre_create",
+		Trigger:  "before tsm creates a session (failure aborts)",
+		Commands: func(c Config) []string { return c.Hooks.PreCreate },
+	},
+	{
+		Key:      "hooks.post_create",
+		Trigger:  "after tsm creates a session (failures are logged)",
+		Commands: func(c Config) []string { return c.Hooks.PostCreate },
+	},
+}
+
+// shellArgv returns the shell and flag used to run a command string.
+func shellArgv() (string, string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", "/C"
+	}
+	return "sh", "-c"
+}
+
+// hookArgv returns the command line that runs command with the shell and
+// env (KEY=VALUE pairs) added to its environment.
+func hookArgv(command string, env ...string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		var b strings.Builder
+		for _, e := range env {
+			b.WriteString(`set "` + e + `"&& `)
+		}
+		return "cmd", []string{"/C", b.String() + command}
+	}
+	return "env", append(env, "sh", "-c", command)
+}
+
+// runCreateHook runs a hooks.pre_create or hooks.post_create command for
+// session sess in dir.
+func runCreateHook(ctx context.Context, command, sess, dir string) error {
+	name, args := hookArgv(command, "TSM_SESSION="+sess, "TSM_DIR="+dir)
+	return shell.Run(ctx, name, args...)
+}
+
+// testHook runs command in a subprocess the way a create hook runs, for the
+// session hookTestSession in dir, with TSM_HOOK_TEST=1 so scripts can skip
+// their side effects, and reports the outcome. A dry run skips it.
+func testHook(ctx context.Context, command, dir string) string {
+	if _, dry := shell.(dryRunShell); dry {
+		return "skipped (dry run)"
+	}
+	name, args := hookArgv(command, "TSM_SESSION="+hookTestSession, "TSM_DIR="+dir, "TSM_HOOK_TEST=1")
+	if err := shell.Run(ctx, name, args...); err != nil {
+		return "FAIL: " + err.Error()
+	}
+	return "ok"
+}
+
+// hookTestSession is the TSM_SESSION that list-hooks -test passes.
+const hookTestSession = "tsm-hook-test"
+
+func init() {
+	registerCommand(Command{
+		Name:    "list-hooks",
+		Summary: "Show the configured hooks and when they run",
+		Run:     runListHooks,
+	})
+}
+
+func runListHooks(opts Options, args []string) error {
+	fs := flag.NewFlagSet("list-hooks", flag.ContinueOnError)
+	test := fs.Bool("test", false, "Run each hook command once in a subprocess and report whether it succeeds")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	header := "HOOK\tACTIVE\tTRIGGER\tCOMMAND"
+	if *test {
+		header += "\tTEST"
+	}
+	_, _ = fmt.Fprintln(tw, header)
+	for _, h := range hookSpecs {
+		cmds := h.Commands(cfg)
+		if len(cmds) == 0 {
+			_, _ = fmt.Fprintf(tw, "%s\tno\t%s\t-\n", h.Key, h.Trigger)
+			continue
+		}
+		for i, c := range cmds {
+			key := h.Key
+			if len(cmds) > 1 {
+				key += "[" + strconv.Itoa(i) + "]"
+			}
+			row := fmt.Sprintf("%s\tyes\t%s\t%s", key, h.Trigger, c)
+			if *test {
+				row += "\t" + testHook(ctx, c, dir)
+			}
+			_, _ = fmt.Fprintln(tw, row)
+		}
+	}
+	return tw.Flush()
+}
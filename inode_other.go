@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// fileInode is unsupported on this platform.
+func fileInode(fs.FileInfo) (dev, ino uint64, ok bool) { return 0, 0, false }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ---------------- Window layouts ----------------
+
+// LayoutWindow is one extra window opened in a new session.
+type LayoutWindow struct {
+	Name string `mapstructure:"name"`
+	Dir  string `mapstructure:"dir"` // relative to the session directory
+	Cmd  string `mapstructure:"cmd"` // typed into the window once it is open
+}
+
+// layoutFor returns the windows of the layout whose glob in cfg.Layouts
+// matches dir. Patterns are tried in sorted order and matched
+// case-insensitively, since viper lowercases map keys.
+// A project file's layout (cfg.ProjectLayout) takes precedence.
+func layoutFor(cfg Config, dir string) ([]LayoutWindow, error) {
+	if cfg.ProjectLayout != nil {
+		return cfg.ProjectLayout, nil
+	}
+	p := strings.ToLower(filepath.ToSlash(dir))
+	for _, glob := range slices.Sorted(maps.Keys(cfg.Layouts)) {
+		re, err := globRegexp(strings.ToLower(glob))
+		if err != nil {
+			return nil, fmt.Errorf("layouts: %w", err)
+		}
+		if !re.MatchString(p) {
+			continue
+		}
+		name := cfg.Layouts[glob]
+		wins, ok := cfg.LayoutDefinitions[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("layouts: %q refers to undefined layout %q", glob, name)
+		}
+		return wins, nil
+	}
+	return nil, nil
+}
+
+// openLayoutWindows opens wins in sess after its first window, each in its
+// directory below dir, and types their commands.
+func openLayoutWindows(ctx context.Context, sess, dir string, wins []LayoutWindow) error {
+	for _, w := range wins {
+		wdir := dir
+		if w.Dir != "" {
+			wdir = filepath.Join(dir, w.Dir)
+		}
+		args := []string{"new-window", "-t", sess, "-c", wdir}
+		if w.Name != "" {
+			args = append(args, "-n", w.Name)
+		}
+		if err := shell.Run(ctx, "tmux", args...); err != nil {
+			return fmt.Errorf("window %q: %w", w.Name, err)
+		}
+		if w.Cmd != "" {
+			// the new window is now the session's current one
+			if err := shell.Run(ctx, "tmux", "send-keys", "-t", sess, w.Cmd, "Enter"); err != nil {
+				return fmt.Errorf("window %q: %w", w.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ---------------- new-layout ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "new-layout",
+		Summary: "Create a session with named windows and switch to it: new-layout <name> <window:path>...",
+		Run:     runNewLayout,
+	})
+}
+
+// layoutWindowSpec is one <window-name>:<path> argument of new-layout.
+type layoutWindowSpec struct {
+	Name string
+	Dir  string
+}
+
+func parseLayoutWindowSpec(arg string) (layoutWindowSpec, error) {
+	name, path, ok := strings.Cut(arg, ":")
+	if !ok || name == "" || path == "" {
+		return layoutWindowSpec{}, fmt.Errorf("invalid window %q (want <window-name>:<path>)", arg)
+	}
+	dir, ok := expandPath(path)
+	if !ok {
+		return layoutWindowSpec{}, fmt.Errorf("window %q: cannot resolve path %q", name, path)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return layoutWindowSpec{}, fmt.Errorf("window %q: not a directory: %s", name, dir)
+	}
+	return layoutWindowSpec{Name: name, Dir: dir}, nil
+}
+
+// createLayoutSession creates sess with one window per spec, the first
+// through createSessionForDir. An existing session is left as it is.
+func createLayoutSession(ctx context.Context, cfg Config, sess string, wins []layoutWindowSpec) error {
+	sess, created, err := createSessionForDir(ctx, cfg, sess, wins[0].Dir)
+	if err != nil || !created {
+		return err
+	}
+	if err := shell.Run(ctx, "tmux", "rename-window", "-t", sess+":^", wins[0].Name); err != nil {
+		return fmt.Errorf("window %q: %w", wins[0].Name, err)
+	}
+	for _, w := range wins[1:] {
+		if err := shell.Run(ctx, "tmux", "new-window", "-t", sess, "-c", w.Dir, "-n", w.Name); err != nil {
+			return fmt.Errorf("window %q: %w", w.Name, err)
+		}
+	}
+	return shell.Run(ctx, "tmux", "select-window", "-t", sess+":^")
+}
+
+func runNewLayout(opts Options, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: tsm new-layout <name> <window-name>:<path>...")
+	}
+	sess := sanitize(args[0])
+	wins := make([]layoutWindowSpec, 0, len(args)-1)
+	for _, a := range args[1:] {
+		w, err := parseLayoutWindowSpec(a)
+		if err != nil {
+			return err
+		}
+		wins = append(wins, w)
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if err := createLayoutSession(ctx, cfg, sess, wins); err != nil {
+		return err
+	}
+	return switchToSession(ctx, cfg, sess, isInTmux())
+}
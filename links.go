@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ---------------- Session links ----------------
+
+// Links maps a tmux session name to a directory, for sessions that don't
+// correspond to any discovered repo or bookmark.
+type Links map[string]string
+
+func xdgDataDir() (string, error) {
+	xdg := os.Getenv("XDG_DATA_HOME")
+	if xdg == "" {
+		home, _ := os.UserHomeDir()
+		if home == "" {
+			return "", errors.New("cannot resolve $HOME for XDG")
+		}
+		xdg = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(xdg, appName), nil
+}
+
+func linksPath() (string, error) {
+	dir, err := xdgDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "links.yaml"), nil
+}
+
+// loadLinks reads links.yaml; a missing file yields an empty set.
+func loadLinks() (Links, error) {
+	path, err := linksPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Links{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	links := Links{}
+	if err := yaml.Unmarshal(data, &links); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return links, nil
+}
+
+func saveLinks(links Links) error {
+	path, err := linksPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(links)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "link",
+		Summary:     "Associate a path with an existing session: link <session> <path>",
+		Run:         runLink,
+		SessionArgs: true,
+	})
+}
+
+func runLink(opts Options, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: tsm link <session> <path>")
+	}
+	sess := args[0]
+	dir, ok := expandPath(args[1])
+	if !ok {
+		return fmt.Errorf("cannot resolve path %q", args[1])
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+
+	links, err := loadLinks()
+	if err != nil {
+		return err
+	}
+	links[sess] = dir
+	if err := saveLinks(links); err != nil {
+		return err
+	}
+	fmt.Printf("%s -> %s\n", sess, dir)
+	return nil
+}
+
+// brokenLinks returns the sessions whose linked directory no longer exists,
+// sorted by name.
+func brokenLinks(links Links) []string {
+	var broken []string
+	for sess, dir := range links {
+		if !isDir(dir) {
+			broken = append(broken, sess)
+		}
+	}
+	slices.Sort(broken)
+	return broken
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "repair-links",
+		Summary: "Report or fix links whose directory is gone: repair-links [-auto-remove|-interactive]",
+		Run:     runRepairLinks,
+	})
+}
+
+func runRepairLinks(_ Options, args []string) error {
+	fs := flag.NewFlagSet("repair-links", flag.ContinueOnError)
+	autoRemove := fs.Bool("auto-remove", false, "Remove every broken link without asking")
+	interactive := fs.Bool("interactive", false, "Ask whether to delete, re-point or keep each broken link")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *autoRemove && *interactive {
+		return errors.New("usage: tsm repair-links [-auto-remove|-interactive]")
+	}
+
+	links, err := loadLinks()
+	if err != nil {
+		return err
+	}
+	broken := brokenLinks(links)
+	if len(broken) == 0 {
+		fmt.Println("All links are valid")
+		return nil
+	}
+
+	changed := false
+	for _, sess := range broken {
+		fmt.Printf("broken: %s -> %s\n", sess, links[sess])
+		switch {
+		case *autoRemove:
+			delete(links, sess)
+			changed = true
+		case *interactive:
+			if repairLinkInteractive(links, sess) {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveLinks(links)
+}
+
+// repairLinkInteractive prompts until the user deletes, re-points or keeps
+// the link for sess, reporting whether links was modified.
+func repairLinkInteractive(links Links, sess string) bool {
+	for {
+		switch strings.ToLower(ask("  [d]elete, [n]ew path, [k]eep?")) {
+		case "d", "delete":
+			delete(links, sess)
+			return true
+		case "n", "new":
+			answer := ask("  new path:")
+			if answer == "" {
+				return false // nothing typed: keep the link as it is
+			}
+			dir, ok := expandPath(answer)
+			if !ok || !isDir(dir) {
+				fmt.Println("  not a directory")
+				continue
+			}
+			links[sess] = dir
+			return true
+		case "", "k", "keep":
+			return false
+		}
+	}
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "check-stale-sessions",
+		Summary: "List sessions whose directory was deleted: check-stale-sessions [-kill-stale]",
+		Run:     runCheckStaleSessions,
+	})
+}
+
+// staleSession is a running session whose directory no longer exists.
+type staleSession struct {
+	Name, Path string
+}
+
+// sessionWorkDir returns the linked directory of sess, else the current
+// path of its active pane ("" when tmux cannot tell).
+func sessionWorkDir(ctx context.Context, links Links, sess string) string {
+	if dir := links[sess]; dir != "" {
+		return dir
+	}
+	out, err := shell.Output(ctx, "tmux", "display-message", "-t", sess, "-p", "#{pane_current_path}")
+	if err != nil {
+		return ""
+	}
+	// Linux reports the cwd of a process whose directory was removed with
+	// this suffix
+	return strings.TrimSuffix(strings.TrimSpace(string(out)), " (deleted)")
+}
+
+// staleSessions returns the sessions whose directory is gone, in the order
+// given. Sessions without a known directory are skipped.
+func staleSessions(ctx context.Context, sessions []string, links Links) []staleSession {
+	var stale []staleSession
+	for _, s := range sessions {
+		dir := sessionWorkDir(ctx, links, s)
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			stale = append(stale, staleSession{Name: s, Path: dir})
+		}
+	}
+	return stale
+}
+
+func runCheckStaleSessions(opts Options, args []string) error {
+	fs := flag.NewFlagSet("check-stale-sessions", flag.ContinueOnError)
+	kill := fs.Bool("kill-stale", false, "Kill the stale sessions")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	sessions, err := tmuxSessions(ctx)
+	if err != nil {
+		return err
+	}
+	links, _ := loadLinks() // best-effort; pane paths still work
+
+	stale := staleSessions(ctx, sessions, links)
+	if len(stale) == 0 {
+		fmt.Println("No stale sessions")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SESSION\tLAST PATH")
+	for _, s := range stale {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", s.Name, s.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !*kill {
+		return nil
+	}
+	var errs []error
+	for _, s := range stale {
+		if err := killSession(ctx, s.Name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("Killed %s\n", s.Name)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ---------------- Logging ----------------
+
+// setupLogging installs the default slog logger. level falls back to
+// $TSM_LOG_LEVEL and then "info"; format is "text" or "json".
+func setupLogging(w io.Writer, level, format string) error {
+	if level == "" {
+		level = os.Getenv("TSM_LOG_LEVEL")
+	}
+	var lvl slog.Level
+	switch strings.ToLower(level) {
+	case "", "info":
+		lvl = slog.LevelInfo
+	case "debug":
+		lvl = slog.LevelDebug
+	case "warn", "warning":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		return fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+
+	hopts := &slog.HandlerOptions{Level: lvl}
+	out := &heldWriter{w: w}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		h = slog.NewTextHandler(out, hopts)
+	case "json":
+		h = slog.NewJSONHandler(out, hopts)
+	default:
+		return fmt.Errorf("invalid log format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(h))
+	logOut = out
+	return nil
+}
+
+// heldWriter passes log records through to w, except while held, when it
+// buffers them so they cannot tear through the raw-mode picker.
+type heldWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	held bool
+	buf  bytes.Buffer
+}
+
+// logOut is the writer behind the logger installed by setupLogging.
+var logOut = &heldWriter{w: os.Stderr}
+
+func (h *heldWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.held {
+		return h.buf.Write(p)
+	}
+	return h.w.Write(p)
+}
+
+// holdLogs buffers log output until the returned release func is called,
+// which writes out everything logged in between.
+func holdLogs() (release func()) {
+	h := logOut
+	h.mu.Lock()
+	h.held = true
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.held = false
+		_, _ = h.w.Write(h.buf.Bytes())
+		h.buf.Reset()
+	}
+}
+
+// logError reports err at error level with an actionable hint when known.
+func logError(msg string, err error, args ...any) {
+	args = append(args, "err", err)
+	if hint := errorHint(err); hint != "" {
+		args = append(args, "hint", hint)
+	}
+	slog.Error(msg, args...)
+}
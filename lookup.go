@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// ---------------- Item lookup ----------------
+
+// findItem resolves name against items: exact name first, then name prefix,
+// then the best fuzzy match under m. With exact set only the first step
+// applies.
+func findItem(items []Item, name string, exact bool, m MatchOptions) (Item, bool) {
+	var pathless *Item
+	for i, it := range items {
+		if it.Name != name {
+			continue
+		}
+		// prefer an entry that knows its path (linked session, repo, bookmark)
+		if it.Path != "" {
+			return it, true
+		}
+		if pathless == nil {
+			pathless = &items[i]
+		}
+	}
+	if pathless != nil {
+		return *pathless, true
+	}
+	if exact {
+		return Item{}, false
+	}
+	for _, it := range items {
+		if strings.HasPrefix(it.Name, name) {
+			return it, true
+		}
+	}
+	if cands := filterAndRank(items, name, 1, m); len(cands) > 0 {
+		return cands[0].Item, true
+	}
+	return Item{}, false
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "path",
+		Summary:     "Print the directory of a session, repo or bookmark: path [-exact] <name>",
+		Run:         runPath,
+		SessionArgs: true,
+	})
+}
+
+func runPath(opts Options, args []string) error {
+	fs := flag.NewFlagSet("path", flag.ContinueOnError)
+	exact := fs.Bool("exact", false, "Require an exact name match")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tsm path [-exact] <name>")
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := cfg.matchOptions()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+
+	it, ok := findItem(buildItems(ctx, cfg), fs.Arg(0), *exact, m)
+	if !ok {
+		return fmt.Errorf("no item matches %q", fs.Arg(0))
+	}
+	if it.Path == "" {
+		return fmt.Errorf("%s has no known path (link it with `tsm link`)", it.Name)
+	}
+	fmt.Println(it.Path)
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "switch",
+		Summary:     "Switch to or create a session by name without the picker: switch [-exact] <name>",
+		Run:         runSwitch,
+		SessionArgs: true,
+	})
+}
+
+// switchByName switches to the session called name, or else to the item
+// findItem resolves name to, creating its session when needed.
+func switchByName(ctx context.Context, cfg Config, name string, exact, inTmux bool) (Item, error) {
+	if hasSession(ctx, name) {
+		return Item{Kind: KindSession, Name: name}, switchToSession(ctx, cfg, name, inTmux)
+	}
+	m, err := cfg.matchOptions()
+	if err != nil {
+		return Item{}, err
+	}
+	it, ok := findItem(buildItems(ctx, cfg), name, exact, m)
+	switch {
+	case !ok:
+		return Item{}, fmt.Errorf("no item matches %q", name)
+	case it.Kind == KindSession:
+		return it, switchToSession(ctx, cfg, it.Name, inTmux)
+	case it.Path == "":
+		return Item{}, fmt.Errorf("%s has no known path", it.Name)
+	}
+	it.Name, err = createOrSwitchForDir(ctx, cfg, it.Name, it.Path, inTmux)
+	return it, err
+}
+
+func runSwitch(opts Options, args []string) error {
+	fs := flag.NewFlagSet("switch", flag.ContinueOnError)
+	exact := fs.Bool("exact", false, "Require an exact name match")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tsm switch [-exact] <name>")
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	it, err := switchByName(ctx, cfg, fs.Arg(0), *exact, isInTmux())
+	if err != nil {
+		return err
+	}
+	_ = appendHistory(it)
+	return nil
+}
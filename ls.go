@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// ---------------- ls ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "ls",
+		Summary: "List sessions, repos and bookmarks without the picker: ls [-output table|json|plain]",
+		Run:     runLs,
+	})
+}
+
+// lsEntry is one ls row. Status is "active" for sessions with a client
+// attached, "inactive" for other sessions and empty for directories.
+type lsEntry struct {
+	Item
+	Status string `json:"status,omitempty"`
+}
+
+// attachedSessions returns the sessions that have at least one client.
+func attachedSessions(ctx context.Context) map[string]bool {
+	out, err := shell.Output(ctx, "tmux", "list-sessions", "-F", "#{session_name}\t#{session_attached}")
+	if err != nil {
+		return nil
+	}
+	res := map[string]bool{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		name, n, ok := strings.Cut(sc.Text(), "\t")
+		if ok && n != "" && n != "0" {
+			res[name] = true
+		}
+	}
+	return res
+}
+
+func lsEntries(items []Item, attached map[string]bool) []lsEntry {
+	entries := make([]lsEntry, 0, len(items))
+	for _, it := range items {
+		e := lsEntry{Item: it}
+		if it.Kind == KindSession {
+			e.Status = "inactive"
+			if attached[it.Name] {
+				e.Status = "active"
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func writeLs(w io.Writer, entries []lsEntry, output string) error {
+	switch output {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KIND\tNAME\tPATH\tSTATUS")
+		for _, e := range entries {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Kind, e.Name, e.Path, e.Status)
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "plain":
+		for _, e := range entries {
+			if _, err := fmt.Fprintln(w, e.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid -output %q (want table, json or plain)", output)
+}
+
+func runLs(opts Options, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	output := fs.String("output", "table", "Output format: table, json (array of {kind, name, path, status}) or plain (names only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	entries := lsEntries(buildItems(ctx, cfg), attachedSessions(ctx))
+	return writeLs(os.Stdout, entries, *output)
+}
@@ -4,22 +4,30 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
 )
 
 const (
@@ -40,15 +48,217 @@ var (
 type Options struct {
 	ConfigPath string
 	Print      bool
+	Clipboard  bool // copy the selected path instead of switching
+	// ClipboardName copies the session name instead of the path.
+	ClipboardName bool
+	// OpenRemote opens the web page of this git remote of the selection
+	// instead of switching. Set by open-url only.
+	OpenRemote string
+	// DetachCurrent detaches other clients from the session we switch away from.
+	DetachCurrent bool
+	NoGit         bool
+	WatchConfig   bool // rebuild the picker list when the config file changes
+	// FollowSymlinks makes the scanner descend into symlinked directories.
+	FollowSymlinks bool
+	ItemCommand    string // shell command printing extra item paths
+	PreviewWidth   string // split preview width: cells or percentage
+	PreviewHeight  string // split preview height: cells or percentage
+	PickAction     string // create (default), switch or kill
+	PrintStats     bool   // with Print, append a "# sessions=…" summary line
+	NoAttach       bool   // create the selected session but don't switch to it
+	Recent         int    // only offer the N most recently used items
+	// SessionNameEnv names an environment variable whose value, when set,
+	// replaces the derived name of a newly created session.
+	SessionNameEnv string
+	PickSeparator  string // joins the fields of picker rows, e.g. "\t" or " | "
+	// FilterPaths keeps only items whose path matches one of these globs.
+	FilterPaths []string
+	// Group keeps only items in this groups label; the picker starts on it.
+	Group string
+	// WindowLayout is a built-in tmux layout for newly created sessions.
+	WindowLayout string
+	Select       bool // print the selected path/name instead of switching
+	// StartupLayout is a YAML file of sessions to create before attaching
+	// to the first one; the picker is skipped.
+	StartupLayout string
+	// InputFile lists paths, one per line, to open as sessions without the
+	// picker.
+	InputFile    string
+	RequireClean bool // only list repos without uncommitted changes
+	// FuzzyThreshold hides matches scoring below this percentage of the
+	// best match; 0 disables it.
+	FuzzyThreshold int
+	NoCache        bool // walk the scan paths without the scan cache
+	RefreshCache   bool // re-walk every scan path and rewrite the scan cache
+	// MaxScanConcurrency overrides max_scan_concurrency when positive.
+	MaxScanConcurrency int
+	Timeout            time.Duration // resolved once by resolveTimeout; see timeout
+	MaxResults         int           // overrides max_results when positive
+	SessionNameMaxLen  int           // overrides session_name_max_len when positive
+	// SessionIdleTimeout overrides session_idle_timeout when positive.
+	SessionIdleTimeout time.Duration
+	ColorScheme        string // picker theme: dark, light or mono
+	PrintJSON          bool   // like Print, as a JSON array of items
+}
+
+// loadRunConfig loads the config and overlays command-line options.
+func loadRunConfig(opts Options) (Config, error) {
+	cfg, err := loadConfig(opts.ConfigPath)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: config error: %w", appName, err)
+	}
+	opts.apply(&cfg)
+	if cfg.Timeout < 0 {
+		return Config{}, fmt.Errorf("%s: timeout: %s is negative", appName, cfg.Timeout)
+	}
+	if err := useNameTemplate(cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: name_template: %w", appName, err)
+	}
+	if err := useSessionNameMaxLen(cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: session_name_max_len: %w", appName, err)
+	}
+	return cfg, nil
+}
+
+// resolveTimeout picks the time limit for the tmux and git calls of one
+// run: the -timeout flag, else the config's timeout key, else
+// defaultTimeout. The config is read best-effort; commands that load it
+// report its errors themselves.
+func resolveTimeout(flagTimeout time.Duration, configPath string) time.Duration {
+	if flagTimeout > 0 {
+		return flagTimeout
+	}
+	if cfg, err := loadConfig(configPath); err == nil && cfg.Timeout > 0 {
+		return cfg.Timeout
+	}
+	return defaultTimeout
+}
+
+// timeout is the limit for the tmux and git calls of this run; a zero
+// Timeout keeps defaultTimeout.
+func (o Options) timeout() time.Duration {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+	return defaultTimeout
+}
+
+// apply overlays command-line options on top of the loaded config.
+func (o Options) apply(cfg *Config) {
+	if o.NoGit {
+		cfg.DisableGitChecks = true
+	}
+	if o.FollowSymlinks {
+		cfg.FollowSymlinks = true
+	}
+	if o.ItemCommand != "" {
+		cfg.ItemCommand = o.ItemCommand
+	}
+	if o.WindowLayout != "" {
+		cfg.WindowLayout = o.WindowLayout
+	}
+	if o.MaxScanConcurrency > 0 {
+		cfg.MaxScanConcurrency = o.MaxScanConcurrency
+	}
+	if o.Timeout > 0 {
+		cfg.Timeout = o.Timeout
+	}
+	if o.MaxResults > 0 {
+		cfg.MaxResults = o.MaxResults
+	}
+	if o.SessionNameMaxLen > 0 {
+		cfg.SessionNameMaxLen = o.SessionNameMaxLen
+	}
+	if o.SessionIdleTimeout > 0 {
+		cfg.SessionIdleTimeout = o.SessionIdleTimeout
+	}
+	cfg.NoCache = o.NoCache
+	cfg.RefreshCache = o.RefreshCache
 }
 
 // ---------------- Config ----------------
 
 type Config struct {
+	Version   int      `mapstructure:"version"` // schema version, see configSchemaVersion
 	ScanPaths []string `mapstructure:"scan_paths"`
 	Bookmarks []string `mapstructure:"bookmarks"`
 	Exclude   []string `mapstructure:"exclude_dirs"`
 	MaxDepth  int      `mapstructure:"max_depth"`
+
+	MaxConfigBackups int  `mapstructure:"max_config_backups"`
+	DisableGitChecks bool `mapstructure:"disable_git_checks"`
+	SplitPreview     bool `mapstructure:"split_preview"`
+	FollowSymlinks   bool `mapstructure:"follow_symlinks"`
+	// ScanSSHConfig lists the Host entries of ~/.ssh/config as bookmarks
+	// whose sessions open an SSH connection.
+	ScanSSHConfig bool `mapstructure:"scan_ssh_config"`
+
+	// ProjectMarkers are file or directory names that make their parent a
+	// candidate, e.g. "go.mod" or "package.json"; defaults to [".git"].
+	ProjectMarkers []string `mapstructure:"project_markers"`
+	// MaxScanConcurrency limits how many scan paths are walked at once;
+	// zero means runtime.NumCPU().
+	MaxScanConcurrency int `mapstructure:"max_scan_concurrency"`
+
+	// CacheTTL bounds how long cached scan results are trusted; zero
+	// disables the scan cache.
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+	// NoCache and RefreshCache bypass or rebuild the scan cache. Set from
+	// -no-cache and -refresh-cache only.
+	NoCache      bool `mapstructure:"-"`
+	RefreshCache bool `mapstructure:"-"`
+
+	// Timeout bounds the tmux and git calls of one run; zero keeps
+	// defaultTimeout.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// SessionIdleTimeout makes the picker first kill detached sessions last
+	// attached longer ago than this; zero keeps every session.
+	SessionIdleTimeout time.Duration `mapstructure:"session_idle_timeout"`
+
+	// NameTemplate is a Go template over NameTemplateData for session names
+	// derived from paths; empty keeps "<parent>_<base>".
+	NameTemplate string `mapstructure:"name_template"`
+	// SessionNameMaxLen shortens derived session names longer than this to
+	// end in "..."; zero keeps them whole.
+	SessionNameMaxLen int `mapstructure:"session_name_max_len"`
+	// CollisionStrategy handles directories that derive the same session
+	// name; empty means CollisionFirst.
+	CollisionStrategy CollisionStrategy `mapstructure:"collision_strategy"`
+
+	// Extra flags for `tmux switch-client` (inside tmux) and `tmux attach`.
+	TmuxSwitchFlags []string `mapstructure:"tmux_switch_flags"`
+	TmuxAttachFlags []string `mapstructure:"tmux_attach_flags"`
+
+	// Hooks; see hookSpecs for when each one runs.
+	Hooks Hooks `mapstructure:"hooks"`
+
+	// Theme overrides colours of the -color-scheme.
+	Theme Theme `mapstructure:"theme"`
+
+	// MaxResults caps the picker list; the terminal height caps it further.
+	MaxResults int `mapstructure:"max_results"`
+
+	// FuzzyMode and CaseSensitive control how picker queries match.
+	FuzzyMode     FuzzyMode `mapstructure:"fuzzy_mode"`
+	CaseSensitive bool      `mapstructure:"case_sensitive"`
+
+	// Layouts maps path globs to names in LayoutDefinitions; a new session
+	// for a matching directory gets that layout's extra windows.
+	Layouts           map[string]string         `mapstructure:"layouts"`
+	LayoutDefinitions map[string][]LayoutWindow `mapstructure:"layout_definitions"`
+
+	// Groups maps labels to path globs; matching items get that Group.
+	Groups map[string][]string `mapstructure:"groups"`
+
+	// ItemCommand is a shell command whose output lines are extra item
+	// paths. Set from -cmd only.
+	ItemCommand string `mapstructure:"-"`
+	// WindowLayout is applied with `tmux select-layout` to newly created
+	// sessions. Set from -window-layout only.
+	WindowLayout string `mapstructure:"-"`
+	// ProjectLayout, when not nil, replaces the layouts match. Set from a
+	// project file's layout only.
+	ProjectLayout []LayoutWindow `mapstructure:"-"`
 }
 
 func defaultExclude() []string {
@@ -63,35 +273,126 @@ func defaultExclude() []string {
 
 func loadConfig(explicit string) (Config, error) {
 	v := viper.New()
-	if explicit != "" {
-		v.SetConfigFile(explicit)
-	} else {
-		xdg := os.Getenv("XDG_CONFIG_HOME")
-		if xdg == "" {
-			home, _ := os.UserHomeDir()
-			xdg = filepath.Join(home, ".config")
+	path := resolveConfigFile(explicit)
+	// The XDG lookup is best-effort; an explicit -config path must exist.
+	if path != "" {
+		if err := readConfigFile(v, path); err != nil && explicit != "" {
+			if errors.Is(err, fs.ErrNotExist) {
+				return Config{}, fmt.Errorf("%w: %s", ErrConfigNotFound, explicit)
+			}
+			return Config{}, err
 		}
-		v.AddConfigPath(filepath.Join(xdg, "tsm"))
-		v.SetConfigName("config")
 	}
-	_ = v.ReadInConfig() // best-effort
 	var cfg Config
 	_ = v.Unmarshal(&cfg)
+	applyConfigDefaults(&cfg, v)
+	return cfg, nil
+}
 
+// applyConfigDefaults fills in the settings v (the loaded file) left unset.
+func applyConfigDefaults(cfg *Config, v *viper.Viper) {
 	if len(cfg.Exclude) == 0 {
 		cfg.Exclude = defaultExclude()
 	}
 	if cfg.MaxDepth == 0 {
 		cfg.MaxDepth = 3
 	}
+	if len(cfg.ProjectMarkers) == 0 {
+		cfg.ProjectMarkers = []string{".git"}
+	}
+	if !v.IsSet("cache_ttl") {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+	if cfg.MaxConfigBackups == 0 {
+		cfg.MaxConfigBackups = 10
+	}
+	if cfg.MaxResults == 0 {
+		cfg.MaxResults = defaultMaxResults
+	}
 	if len(cfg.ScanPaths) == 0 {
 		if home, _ := os.UserHomeDir(); home != "" {
 			cfg.ScanPaths = []string{filepath.Join(home, "Code")}
 		}
 	}
-	return cfg, nil
 }
 
+// resolveConfigFile returns the file loadConfig reads: the explicit path if
+// given, otherwise the first config file in the XDG dir ("" if none).
+func resolveConfigFile(explicit string) string {
+	path, _ := locateConfigFile(explicit)
+	return path
+}
+
+// locateConfigFile is resolveConfigFile that also reports where the path
+// came from: "-config flag", "XDG_CONFIG_HOME" or "$HOME/.config".
+func locateConfigFile(explicit string) (path, source string) {
+	if explicit != "" {
+		return explicit, "-config flag"
+	}
+	xdg, source := os.Getenv("XDG_CONFIG_HOME"), "XDG_CONFIG_HOME"
+	if xdg == "" {
+		home, _ := os.UserHomeDir()
+		xdg, source = filepath.Join(home, ".config"), "$HOME/.config"
+	}
+	return findConfigFile(filepath.Join(xdg, "tsm")), source
+}
+
+// configExts is the order config files are probed in: YAML, TOML and JSON
+// first, then the other formats viper can read.
+var configExts = func() []string {
+	exts := []string{"yaml", "yml", "toml", "json"}
+	for _, e := range viper.SupportedExts {
+		if !slices.Contains(exts, e) {
+			exts = append(exts, e)
+		}
+	}
+	return exts
+}()
+
+// findConfigFile returns the first "config.<ext>" in dir that viper can
+// read, or "" when there is none.
+func findConfigFile(dir string) string {
+	if files := configFiles(dir); len(files) > 0 {
+		return files[0]
+	}
+	return ""
+}
+
+// configFiles returns every config.<ext> file in dir, in configExts order.
+func configFiles(dir string) []string {
+	var files []string
+	for _, ext := range configExts {
+		p := filepath.Join(dir, "config."+ext)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+// readConfigFile loads path into v. YAML is decoded with yaml.v3 and merged
+// via MergeConfigMap so anchors, aliases and merge keys (<<) are honoured;
+// other formats go through viper's own readers.
+func readConfigFile(v *viper.Viper, path string) error {
+	v.SetConfigFile(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return v.ReadInConfig()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return v.MergeConfigMap(m)
+}
+
+// xdgConfigPath returns the config file in the XDG config dir, whatever its
+// format, or the config.yaml path when there is none yet.
 func xdgConfigPath() (string, error) {
 	xdg := os.Getenv("XDG_CONFIG_HOME")
 	if xdg == "" {
@@ -101,10 +402,16 @@ func xdgConfigPath() (string, error) {
 		}
 		xdg = filepath.Join(home, ".config")
 	}
-	return filepath.Join(xdg, "tsm", "config.yaml"), nil
+	dir := filepath.Join(xdg, "tsm")
+	if p := findConfigFile(dir); p != "" {
+		return p, nil
+	}
+	return filepath.Join(dir, "config.yaml"), nil
 }
 
-func writeDefaultConfig(w io.Writer) error {
+// writeDefaultConfig writes a starter config in format (yaml, toml or
+// json; "" means yaml) unless a config of any format already exists.
+func writeDefaultConfig(w io.Writer, format string) error {
 	path, err := xdgConfigPath()
 	if err != nil {
 		return err
@@ -114,10 +421,18 @@ func writeDefaultConfig(w io.Writer) error {
 		return err
 	}
 	if _, err := os.Stat(path); err == nil {
-		return fmt.Errorf("config already exists at %s", path)
+		return fmt.Errorf("%w at %s", ErrConfigExists, path)
+	}
+	switch format {
+	case "", "yaml", "yml":
+	case "toml", "json":
+		return writeDefaultConfigAs(w, filepath.Join(dir, "config."+format))
+	default:
+		return fmt.Errorf("unsupported config format %q (want yaml, toml or json)", format)
 	}
 	var buf bytes.Buffer
 	buf.WriteString("# tsm config\n")
+	fmt.Fprintf(&buf, "version: %d\n", configSchemaVersion)
 	buf.WriteString("scan_paths:\n")
 	buf.WriteString("  - \"$HOME/Code\"\n")
 	buf.WriteString("bookmarks:\n")
@@ -134,6 +449,37 @@ func writeDefaultConfig(w io.Writer) error {
 	return nil
 }
 
+// initConfig implements -init-config: it writes the default config and,
+// with examples, config.example.yaml. An existing config is only an error
+// when no examples were asked for.
+func initConfig(w io.Writer, format string, examples bool) error {
+	err := writeDefaultConfig(w, format)
+	if !examples {
+		return err
+	}
+	if errors.Is(err, ErrConfigExists) {
+		_, _ = fmt.Fprintf(w, "Skipped default config: %v\n", err)
+		err = nil
+	}
+	return errors.Join(err, writeExampleConfig(w))
+}
+
+// writeDefaultConfigAs writes the default settings with viper's encoder
+// for path's extension; unlike the YAML skeleton it carries no comments.
+func writeDefaultConfigAs(w io.Writer, path string) error {
+	v := viper.New()
+	v.Set("version", configSchemaVersion)
+	v.Set("scan_paths", []string{"$HOME/Code"})
+	v.Set("bookmarks", []string{"$HOME"})
+	v.Set("exclude_dirs", defaultExclude())
+	v.Set("max_depth", 3)
+	if err := v.WriteConfigAs(path); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "Wrote default config → %s\n", path)
+	return nil
+}
+
 // ---------------- Items & names ----------------
 
 type ItemKind string
@@ -142,12 +488,16 @@ const (
 	KindSession  ItemKind = "S"
 	KindGitRepo  ItemKind = "G"
 	KindBookmark ItemKind = "B"
+	KindWorktree ItemKind = "W" // linked working tree from `git worktree add`
+	KindProject  ItemKind = "P" // project root found by a non-git marker
 )
 
 type Item struct {
-	Kind ItemKind
-	Name string // tmux session name
-	Path string // directory for G/B
+	Kind ItemKind `json:"kind"`
+	Name string   `json:"name"` // tmux session name
+	Path string   `json:"path"` // directory for G/B, or linked directory for S
+	// Group is the groups label whose globs match Path, if any.
+	Group string `json:"group,omitempty"`
 }
 
 // sanitizeRaw converts a directory segment into a tmux-safe name,
@@ -184,23 +534,44 @@ func sanitize(base string) string {
 	return "session"
 }
 
+// sessionNameFromPath names the session for dir with the configured
+// name_template, falling back to defaultSessionName when there is none or
+// it fails for this path.
+func sessionNameFromPath(dir string) string {
+	limit := int(sessionNameMaxLen.Load())
+	if nt := activeNameTemplate.Load(); nt != nil {
+		if name, err := renderSessionName(nt.tmpl, nameTemplateData(dir, nt.roots)); err == nil {
+			return truncateSessionName(name, limit)
+		}
+	}
+	return truncateSessionName(defaultSessionName(dir), limit)
+}
+
 // "<parent>_<base>" — /home/u/Code/ivuorinen/a -> "ivuorinen_a"
 // Walks up the tree to find the first ancestor whose name has valid characters,
 // skipping segments that are all non-ASCII / special (e.g. "äö!").
-func sessionNameFromPath(dir string) string {
+func defaultSessionName(dir string) string {
 	base := sanitize(filepath.Base(dir))
+	if parent := nearestParentName(dir); parent != "" {
+		return parent + "_" + base
+	}
+	return base
+}
+
+// nearestParentName returns the sanitized name of the closest ancestor of
+// dir that has one, or "" when none does.
+func nearestParentName(dir string) string {
 	d := dir
 	for {
 		parent := filepath.Dir(d)
 		if parent == d { // reached filesystem root
-			break
+			return ""
 		}
 		d = parent
 		if name := sanitizeRaw(filepath.Base(d)); name != "" {
-			return name + "_" + base
+			return name
 		}
 	}
-	return base
 }
 
 // ---------------- Tmux shell abstraction ----------------
@@ -208,28 +579,59 @@ func sessionNameFromPath(dir string) string {
 type Shell interface {
 	Output(ctx context.Context, name string, args ...string) ([]byte, error)
 	Run(ctx context.Context, name string, args ...string) error
+	// IsAvailable reports whether the named binary can be found.
+	IsAvailable(name string) bool
+}
+
+// execShell runs real processes. TmuxArgs are put before the arguments of
+// every tmux command (set from -tmux-args).
+type execShell struct {
+	TmuxArgs []string
 }
 
-type execShell struct{}
+func (e execShell) argv(name string, args []string) []string {
+	if name == "tmux" && len(e.TmuxArgs) > 0 {
+		return slices.Concat(e.TmuxArgs, args)
+	}
+	return args
+}
 
-func (execShell) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+func (e execShell) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	args = e.argv(name, args)
+	slog.Debug("exec", "name", name, "args", args)
 	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Env = os.Environ()
 	return cmd.Output()
 }
-func (execShell) Run(ctx context.Context, name string, args ...string) error {
+func (e execShell) Run(ctx context.Context, name string, args ...string) error {
+	args = e.argv(name, args)
+	slog.Debug("exec", "name", name, "args", args)
 	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Env = os.Environ()
 	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
 	return cmd.Run()
 }
+func (execShell) IsAvailable(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
 
 var shell Shell = execShell{}
 
 func listTmuxSessions(ctx context.Context) []string {
+	res, _ := tmuxSessions(ctx)
+	return res
+}
+
+// tmuxSessions lists session names, sorted. It fails with ErrNoTmux when
+// tmux is missing and with the tmux error when no server is running.
+func tmuxSessions(ctx context.Context) ([]string, error) {
+	if !shell.IsAvailable("tmux") {
+		return nil, fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
 	out, err := shell.Output(ctx, "tmux", "list-sessions", "-F", "#S")
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	var res []string
 	sc := bufio.NewScanner(bytes.NewReader(out))
@@ -240,32 +642,116 @@ func listTmuxSessions(ctx context.Context) []string {
 		}
 	}
 	slices.Sort(res)
-	return res
+	return res, nil
 }
 
 func hasSession(ctx context.Context, name string) bool {
 	return shell.Run(ctx, "tmux", "has-session", "-t", name) == nil
 }
 
-func switchToSession(ctx context.Context, name string, inTmux bool) error {
+// switchToSession moves the current client to name, or attaches a new client
+// outside tmux, adding the configured tmux_switch_flags/tmux_attach_flags.
+func switchToSession(ctx context.Context, cfg Config, name string, inTmux bool) error {
 	if inTmux {
-		return shell.Run(ctx, "tmux", "switch-client", "-t", name)
+		return shell.Run(ctx, "tmux", slices.Concat([]string{"switch-client"}, cfg.TmuxSwitchFlags, []string{"-t", name})...)
+	}
+	return shell.Run(ctx, "tmux", slices.Concat([]string{"attach"}, cfg.TmuxAttachFlags, []string{"-t", name})...)
+}
+
+// newSession starts sess detached in dir, or connected to the host of an
+// ssh:// path.
+func newSession(ctx context.Context, sess, dir string) error {
+	if host, ok := sshHost(dir); ok {
+		return shell.Run(ctx, "tmux", "new-session", "-ds", sess, "ssh "+shellQuote(host))
 	}
-	return shell.Run(ctx, "tmux", "attach", "-t", name)
+	return shell.Run(ctx, "tmux", "new-session", "-ds", sess, "-c", dir)
 }
 
-func createOrSwitchForDir(ctx context.Context, sess, dir string, inTmux bool) error {
+// createOrSwitchForDir creates the session for dir unless it exists, then
+// switches to it. It returns the session name createSessionForDir used.
+func createOrSwitchForDir(ctx context.Context, cfg Config, sess, dir string, inTmux bool) (string, error) {
+	sess, _, err := createSessionForDir(ctx, cfg, sess, dir)
+	if err != nil {
+		return sess, err
+	}
+	return sess, switchToSession(ctx, cfg, sess, inTmux)
+}
+
+// createSessionForDir creates sess in dir unless it exists, with dir's
+// project file merged over cfg, running the create hooks around it and
+// setupNewSession on the new session. It returns the session name, which
+// the project file's name_template may have changed.
+func createSessionForDir(ctx context.Context, cfg Config, sess, dir string) (name string, created bool, err error) {
+	cfg, sess, err = applyProjectConfig(cfg, sess, dir)
+	if err != nil {
+		return sess, false, err
+	}
 	if hasSession(ctx, sess) {
-		return switchToSession(ctx, sess, inTmux)
+		return sess, false, nil
+	}
+	for _, c := range cfg.Hooks.PreCreate {
+		if err := runCreateHook(ctx, c, sess, dir); err != nil {
+			return sess, false, fmt.Errorf("hooks.pre_create %q: %w", c, err)
+		}
+	}
+	if err := newSession(ctx, sess, dir); err != nil {
+		return sess, false, err
+	}
+	if err := setupNewSession(ctx, cfg, sess, dir); err != nil {
+		return sess, true, err
 	}
-	if err := shell.Run(ctx, "tmux", "new-session", "-ds", sess, "-c", dir); err != nil {
+	for _, c := range cfg.Hooks.PostCreate {
+		if err := runCreateHook(ctx, c, sess, dir); err != nil {
+			slog.Warn("hooks.post_create failed", "cmd", c, "err", err)
+		}
+	}
+	return sess, true, nil
+}
+
+// tmuxLayouts are tmux's built-in window layouts.
+var tmuxLayouts = []string{"even-horizontal", "even-vertical", "main-horizontal", "main-vertical", "tiled"}
+
+func validateWindowLayout(layout string) error {
+	if layout == "" || slices.Contains(tmuxLayouts, layout) {
+		return nil
+	}
+	return fmt.Errorf("invalid window layout %q (want one of %s)", layout, strings.Join(tmuxLayouts, ", "))
+}
+
+// setupNewSession prepares a session tsm has just created for dir, before
+// any client switches to it.
+func setupNewSession(ctx context.Context, cfg Config, sess, dir string) error {
+	if cfg.WindowLayout != "" {
+		if err := shell.Run(ctx, "tmux", "select-layout", "-t", sess, cfg.WindowLayout); err != nil {
+			return fmt.Errorf("select-layout: %w", err)
+		}
+	}
+	wins, err := layoutFor(cfg, dir)
+	if err != nil {
 		return err
 	}
-	return switchToSession(ctx, sess, inTmux)
+	return openLayoutWindows(ctx, sess, dir, wins)
+}
+
+func killSession(ctx context.Context, name string) error {
+	if err := shell.Run(ctx, "tmux", "kill-session", "-t", name); err != nil {
+		return fmt.Errorf("kill %s: %w", name, err)
+	}
+	return nil
 }
 
 func isInTmux() bool { return os.Getenv("TMUX") != "" }
 
+// currentSession returns the name of the session the client is attached to,
+// or "" when it cannot be determined.
+func currentSession(ctx context.Context) string {
+	out, err := shell.Output(ctx, "tmux", "display-message", "-p", "#S")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
 // ---------------- Discovery (concurrent) ----------------
 
 func expandPath(p string) (string, bool) {
@@ -289,46 +775,88 @@ func depthFrom(root, path string) int {
 	return len(strings.Split(rel, string(os.PathSeparator)))
 }
 
+// scanGitReposConcurrent returns the directories under the scan paths that
+// contain one of cfg.ProjectMarkers (".git" when unset), sorted.
 func scanGitReposConcurrent(cfg Config) []string {
-	type none struct{}
-	excluded := map[string]none{}
-	for _, n := range cfg.Exclude {
-		excluded[n] = none{}
+	return newRepoScanner(cfg).scan()
+}
+
+// excludeSet matches directory names against exclude_dirs entries: plain
+// names exactly, entries with *, ? or [ as filepath.Match patterns.
+type excludeSet struct {
+	names    map[string]bool
+	patterns []string
+}
+
+func newExcludeSet(entries []string) excludeSet {
+	e := excludeSet{names: map[string]bool{}}
+	for _, n := range entries {
+		e.names[n] = true
+		// a malformed pattern can still match its literal name
+		if _, err := filepath.Match(n, ""); err == nil && strings.ContainsAny(n, "*?[") {
+			e.patterns = append(e.patterns, n)
+		}
+	}
+	return e
+}
+
+func (e excludeSet) match(name string) bool {
+	if e.names[name] {
+		return true
+	}
+	for _, p := range e.patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// repoScanner walks the scan paths for directories holding a project marker.
+type repoScanner struct {
+	cfg      Config
+	markers  map[string]bool
+	excluded excludeSet
+	// descend, when set, is asked before entering each top-level directory
+	// of a scan path; returning false skips that subtree. It may be called
+	// from several goroutines.
+	descend func(dir string) bool
+}
+
+func newRepoScanner(cfg Config) *repoScanner {
+	s := &repoScanner{cfg: cfg, markers: map[string]bool{}, excluded: newExcludeSet(cfg.Exclude)}
+	for _, m := range cfg.ProjectMarkers {
+		s.markers[m] = true
 	}
+	if len(s.markers) == 0 {
+		s.markers[".git"] = true
+	}
+	return s
+}
 
+// scan walks the scan paths concurrently, at most cfg.MaxScanConcurrency at
+// a time, and returns the distinct project roots found, sorted.
+func (s *repoScanner) scan() []string {
+	n := s.cfg.MaxScanConcurrency
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	sem := make(chan struct{}, n)
 	outCh := make(chan string, 256)
 	var wg sync.WaitGroup
 
-	for _, raw := range cfg.ScanPaths {
+	for _, raw := range s.cfg.ScanPaths {
 		root, ok := expandPath(raw)
 		if !ok {
 			continue
 		}
-		wg.Add(1)
-		go func(root string) {
-			defer wg.Done()
-			_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-				if err != nil {
-					return nil
-				}
-				if d.IsDir() {
-					if cfg.MaxDepth > 0 && depthFrom(root, path) > cfg.MaxDepth {
-						return fs.SkipDir
-					}
-					name := d.Name()
-					if name != ".git" {
-						if _, skip := excluded[name]; skip {
-							return fs.SkipDir
-						}
-					}
-					if name == ".git" {
-						outCh <- filepath.Dir(path)
-						return fs.SkipDir
-					}
-				}
-				return nil
-			})
-		}(root)
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := s.walk(root, func(dir string) { outCh <- dir }); err != nil {
+				slog.Warn("scan path skipped", "err", err, "hint", errorHint(err))
+			}
+		})
 	}
 
 	go func() {
@@ -348,16 +876,135 @@ func scanGitReposConcurrent(cfg Config) []string {
 	return repos
 }
 
+// walk reports every project root under root to emit. It fails with
+// ErrScanFailed only when root itself cannot be read; unreadable entries
+// below it are skipped.
+func (s *repoScanner) walk(root string, emit func(string)) error {
+	walk := filepath.WalkDir
+	if s.cfg.FollowSymlinks {
+		walk = walkDirFollow
+	}
+	return walk(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return fmt.Errorf("%w: %w", ErrScanFailed, err)
+			}
+			return nil
+		}
+		name := d.Name()
+		marker := s.markers[name]
+		if d.IsDir() {
+			depth := depthFrom(root, path)
+			if s.cfg.MaxDepth > 0 && depth > s.cfg.MaxDepth {
+				return fs.SkipDir
+			}
+			if marker {
+				emit(filepath.Dir(path))
+				return fs.SkipDir
+			}
+			if s.excluded.match(name) {
+				return fs.SkipDir
+			}
+			if depth == 1 && s.descend != nil && !s.descend(path) {
+				return fs.SkipDir
+			}
+		} else if marker && (s.cfg.MaxDepth <= 0 || depthFrom(root, path) <= s.cfg.MaxDepth) &&
+			(name != ".git" || isWorktree(filepath.Dir(path))) {
+			emit(filepath.Dir(path))
+		}
+		return nil
+	})
+}
+
+// isWorktree reports whether dir is a linked worktree: its .git is a file
+// whose gitdir points into the main repository's .git/worktrees/.
+func isWorktree(dir string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, ".git"))
+	if err != nil {
+		return false
+	}
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	return ok && strings.Contains(filepath.ToSlash(gitdir), "/worktrees/")
+}
+
 // ---------------- Fuzzy UI ----------------
 
-func fuzzyScore(needle, hay string) int {
+// FuzzyMode selects how a query has to occur in an item to match.
+type FuzzyMode string
+
+const (
+	FuzzyModeSubsequence FuzzyMode = "subsequence" // query characters in order, gaps allowed
+	FuzzyModeExact       FuzzyMode = "exact"       // query appears as a substring
+	FuzzyModePrefix      FuzzyMode = "prefix"      // item name starts with the query
+)
+
+func parseFuzzyMode(s string) (FuzzyMode, error) {
+	switch m := FuzzyMode(s); m {
+	case "":
+		return FuzzyModeSubsequence, nil
+	case FuzzyModeSubsequence, FuzzyModeExact, FuzzyModePrefix:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid fuzzy_mode %q (want subsequence, exact or prefix)", s)
+}
+
+// MatchOptions tunes fuzzy matching; the zero value is case-insensitive
+// subsequence matching.
+type MatchOptions struct {
+	Mode          FuzzyMode
+	CaseSensitive bool
+}
+
+// matchOptions returns cfg's fuzzy_mode and case_sensitive settings.
+func (cfg Config) matchOptions() (MatchOptions, error) {
+	mode, err := parseFuzzyMode(string(cfg.FuzzyMode))
+	return MatchOptions{Mode: mode, CaseSensitive: cfg.CaseSensitive}, err
+}
+
+func fuzzyScore(needle, hay string, m MatchOptions) int {
+	d, ok := fuzzyScoreDetail(needle, hay, m)
+	if !ok {
+		return -1
+	}
+	return d.total()
+}
+
+// fuzzyDetail splits a fuzzy score into its parts: 2 per matched byte, a
+// bonus for consecutive matches and a bonus when hay starts with needle.
+type fuzzyDetail struct {
+	Base, Streak, Prefix int
+}
+
+func (d fuzzyDetail) total() int { return d.Base + d.Streak + d.Prefix }
+
+// fuzzyScoreDetail reports whether needle matches hay under m and how it
+// scored.
+func fuzzyScoreDetail(needle, hay string, m MatchOptions) (fuzzyDetail, bool) {
 	if needle == "" {
-		return 1
+		return fuzzyDetail{Base: 1}, true
+	}
+	if !m.CaseSensitive {
+		needle, hay = strings.ToLower(needle), strings.ToLower(hay)
+	}
+	prefix := strings.HasPrefix(hay, needle)
+	switch m.Mode {
+	case FuzzyModePrefix:
+		if !prefix {
+			return fuzzyDetail{}, false
+		}
+	case FuzzyModeExact:
+		i := strings.Index(hay, needle)
+		if i < 0 {
+			return fuzzyDetail{}, false
+		}
+		hay = hay[i:] // score the contiguous occurrence
 	}
-	ni, score, streak := 0, 0, 0
+	var d fuzzyDetail
+	ni, streak := 0, 0
 	for i := 0; i < len(hay) && ni < len(needle); i++ {
-		if toLower(hay[i]) == toLower(needle[ni]) {
-			score += 2 + streak
+		if hay[i] == needle[ni] {
+			d.Base += 2
+			d.Streak += streak
 			ni++
 			streak++
 		} else {
@@ -365,19 +1012,12 @@ func fuzzyScore(needle, hay string) int {
 		}
 	}
 	if ni < len(needle) {
-		return -1
+		return fuzzyDetail{}, false
 	}
-	if strings.HasPrefix(strings.ToLower(hay), strings.ToLower(needle)) {
-		score += 5
-	}
-	return score
-}
-
-func toLower(b byte) byte {
-	if b >= 'A' && b <= 'Z' {
-		return b + 32
+	if prefix {
+		d.Prefix = 5
 	}
-	return b
+	return d, true
 }
 
 type viewItem struct {
@@ -385,14 +1025,18 @@ type viewItem struct {
 	score int
 }
 
-func filterAndRank(items []Item, q string, limit int) []viewItem {
+// matchKey is the text a query is matched against: name, then path.
+func matchKey(it Item) string {
+	if it.Path != "" {
+		return it.Name + " " + it.Path
+	}
+	return it.Name
+}
+
+func filterAndRank(items []Item, q string, limit int, m MatchOptions) []viewItem {
 	var out []viewItem
 	for _, it := range items {
-		key := it.Name
-		if it.Path != "" {
-			key += " " + it.Path
-		}
-		if s := fuzzyScore(q, key); s >= 0 {
+		if s := fuzzyScore(q, matchKey(it), m); s >= 0 {
 			out = append(out, viewItem{Item: it, score: s})
 		}
 	}
@@ -408,12 +1052,96 @@ func filterAndRank(items []Item, q string, limit int) []viewItem {
 	return out
 }
 
-func interactiveSelect(items []Item) (Item, error) {
+// applyThreshold drops ranked candidates scoring below threshold percent of
+// the best score. cands must be sorted best first; 0 keeps everything.
+func applyThreshold(cands []viewItem, threshold int) []viewItem {
+	if threshold <= 0 || len(cands) == 0 {
+		return cands
+	}
+	best := cands[0].score
+	for i, c := range cands {
+		if c.score*100 < best*threshold {
+			return cands[:i]
+		}
+	}
+	return cands
+}
+
+// PickAction is what the picker does with the selected item.
+type PickAction string
+
+const (
+	ActionCreate PickAction = "create" // switch, creating sessions for dirs as needed
+	ActionSwitch PickAction = "switch" // only switch to existing sessions
+	ActionKill   PickAction = "kill"   // kill the selected session
+)
+
+func parsePickAction(s string) (PickAction, error) {
+	switch a := PickAction(s); a {
+	case "":
+		return ActionCreate, nil
+	case ActionCreate, ActionSwitch, ActionKill:
+		return a, nil
+	}
+	return "", fmt.Errorf("invalid pick action %q (want create, switch or kill)", s)
+}
+
+// filterForAction drops items the action cannot apply to: switch and kill
+// only work on live sessions.
+func filterForAction(items []Item, action PickAction) []Item {
+	if action != ActionSwitch && action != ActionKill {
+		return items
+	}
+	var out []Item
+	for _, it := range items {
+		if it.Kind == KindSession {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// UIOptions tunes the interactive picker.
+type UIOptions struct {
+	Action       PickAction
+	SplitPreview bool // persistent preview in the right half of the terminal
+	// PreviewWidth/PreviewHeight size the split preview; zero means half the
+	// width and all available lines.
+	PreviewWidth, PreviewHeight sizeSpec
+	// Reload delivers replacement item lists (e.g. after a config change);
+	// they are picked up on the next keypress.
+	Reload <-chan []Item
+	// Separator joins kind, name and path in list rows instead of the
+	// default fixed-width padding.
+	Separator string
+	// OnKill, when set, is called for the highlighted session on Ctrl-K;
+	// the picker stays open and drops the session from the list.
+	OnKill func(Item) error
+	// FuzzyThreshold hides matches scoring below this percentage of the
+	// best match (0-100).
+	FuzzyThreshold int
+	// Theme colours the list; it is ignored when stdout takes no colours.
+	Theme ThemeColors
+	Match MatchOptions
+	// MaxResults caps the list before resultLimit fits it to the terminal.
+	MaxResults int
+	// Locked marks sessions locked with `tsm lock` in the list.
+	Locked map[string]bool
+	// Groups are the groups labels Ctrl-G cycles through; Group is the one
+	// shown first ("" for all items).
+	Groups []string
+	Group  string
+}
+
+func interactiveSelect(items []Item, ui UIOptions) (Item, error) {
+	group := ui.Group
+	all := filterForAction(items, ui.Action) // every group; items is the shown one
+	items = filterByGroup(all, group)
 	if runtime.GOOS == "windows" {
 		fmt.Println("Query: ")
 		var q string
 		_, _ = fmt.Scanln(&q)
-		cands := filterAndRank(items, q, 20)
+		cands := applyThreshold(filterAndRank(items, q, ui.MaxResults, ui.Match), ui.FuzzyThreshold)
 		for i, v := range cands {
 			fmt.Printf("%2d) %-3s %-24s %s\n", i+1, v.Kind, v.Name, v.Path)
 		}
@@ -428,47 +1156,114 @@ func interactiveSelect(items []Item) (Item, error) {
 
 	_, restore, err := enableRawMode()
 	if err != nil {
-		return promptOnce(items)
+		return promptOnce(items, ui.MaxResults, ui.Match)
 	}
+	release := holdLogs() // e.g. config reload warnings would garble the list
+	defer release()       // after restore, so the records print normally
 	defer restore()
 
+	var termRows atomic.Int64 // updated on resize, read while ranking
+	rows, _ := termSize()
+	termRows.Store(int64(rows))
+	rank := func(items []Item, q string) []viewItem {
+		limit := resultLimit(ui.MaxResults, int(termRows.Load()))
+		return applyThreshold(filterAndRank(items, q, limit, ui.Match), ui.FuzzyThreshold)
+	}
 	query := ""
+	ranked := rankResult{cands: rank(items, "")} // what the list shows
+	// current returns the candidates for query, ranking now if the
+	// debounced ranking has not caught up yet.
+	current := func() []viewItem {
+		if ranked.query != query {
+			ranked = rankResult{query: query, cands: rank(items, query)}
+		}
+		return ranked.cands
+	}
 	idx := 0
-	showPreview := false
+	showPreview := ui.SplitPreview
+	status := ""      // result of the last Ctrl-K, shown under the query
+	var mu sync.Mutex // render may also run from the resize handler
+	color := colorOutput(os.Stdout)
 
 	render := func() {
 		clearScreen()
-		fmt.Printf("tsm — %s (commit %s) — filter (↑/↓, Ctrl-N/P, Enter, Backspace, Ctrl-U, Tab, Home/End, PgUp/PgDn, Ctrl-C)\n", version, commit)
-		fmt.Printf("> %s\n\n", query)
-		cands := filterAndRank(items, query, 30)
+		killHint := ""
+		if ui.OnKill != nil {
+			killHint = ", Ctrl-K [K]ill"
+		}
+		if len(ui.Groups) > 0 {
+			killHint += ", Ctrl-G group"
+		}
+		title := fmt.Sprintf("tsm %s %s (commit %s) %s [%s] filter (%s, Ctrl-N/P, Enter%s, Backspace, Ctrl-U, Tab, Home/End, PgUp/PgDn, Ctrl-F/B, Ctrl-C)",
+			glyph("—", "-"), version, commit, glyph("—", "-"), ui.Action, glyph("↑/↓", "Up/Down"), killHint)
+		fmt.Println(paint(title, ui.Theme.Header, color))
+		prompt := ">"
+		if group != "" {
+			prompt = "[" + group + "] >"
+		}
+		fmt.Printf("%s %s\n%s\n", prompt, query, status)
+		cands := ranked.cands
 		if idx >= len(cands) {
 			idx = len(cands) - 1
 		}
 		if idx < 0 {
 			idx = 0
 		}
-		for i, v := range cands {
-			prefix := "  "
-			if i == idx {
-				prefix = "➤ "
-			}
-			fmt.Printf("%s%-3s %-24s %s\n", prefix, v.Kind, v.Name, v.Path)
-		}
-		if showPreview && len(cands) > 0 {
-			sel := cands[idx].Item
-			fmt.Println("\n--- preview ---")
-			switch sel.Kind {
-			case KindSession:
-				fmt.Printf("Action : switch to session \"%s\"\n", sel.Name)
-			default:
-				fmt.Printf("Action : new-session -ds %q -c %q; switch/attach\n", sel.Name, sel.Path)
-			}
-			if sel.Path != "" {
-				fmt.Printf("Path   : %s\n", sel.Path)
-			}
+		listWidth, previewWidth, previewHeight := 0, 0, 0
+		if ui.SplitPreview && showPreview && termCaps.CursorMovement {
+			rows, cols := termSize()
+			listWidth, previewWidth, previewHeight = splitLayout(rows, cols, ui)
+		}
+		renderList(cands, idx, listWidth, ui, color)
+		if !showPreview || len(cands) == 0 {
+			return
+		}
+		sel := cands[idx].Item
+		if listWidth > 0 {
+			renderSidePreview(sel, ui.Action, listHeaderLines+1, listWidth+2, previewWidth-2, previewHeight)
+			return
+		}
+		fmt.Println("\n--- preview ---")
+		for _, l := range previewLines(sel, ui.Action) {
+			fmt.Println(l)
 		}
 	}
 
+	resized, stopResize := notifyResize()
+	defer stopResize()
+	go func() {
+		for range resized {
+			rows, _ := termSize()
+			termRows.Store(int64(rows))
+			mu.Lock()
+			ranked = rankResult{query: query, cands: rank(items, query)}
+			render() // recalculates the split for the new size
+			mu.Unlock()
+		}
+	}()
+
+	// Typing only schedules a ranking; its result is drawn when it arrives,
+	// so navigation keys stay responsive with very large lists.
+	debounce := newRankDebouncer(queryDebounce, rank)
+	defer debounce.stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case res := <-debounce.C:
+				mu.Lock()
+				if res.query == query && res.query != ranked.query {
+					ranked = res
+					render()
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
 	readKey := bufio.NewReader(os.Stdin)
 	render()
 	for {
@@ -476,15 +1271,42 @@ func interactiveSelect(items []Item) (Item, error) {
 		if err != nil {
 			return Item{}, err
 		}
+		mu.Lock()
+		select {
+		case fresh := <-ui.Reload:
+			all = filterForAction(fresh, ui.Action)
+			items = filterByGroup(all, group)
+			ranked = rankResult{query: query, cands: rank(items, query)}
+		default:
+		}
 		switch r {
 		case 3: // Ctrl-C
-			return Item{}, errors.New("cancelled")
+			mu.Unlock()
+			return Item{}, ErrCancelled
 		case 13: // Enter
-			cands := filterAndRank(items, query, 30)
+			cands := current()
 			if len(cands) == 0 {
+				mu.Unlock()
 				continue
 			}
-			return cands[idx].Item, nil
+			mu.Unlock()
+			return cands[min(idx, len(cands)-1)].Item, nil
+		case 11: // Ctrl-K
+			cands := current()
+			if ui.OnKill == nil || len(cands) == 0 {
+				break
+			}
+			all, status = killFromPicker(ui, all, cands[min(idx, len(cands)-1)].Item)
+			items = filterByGroup(all, group)
+			ranked = rankResult{query: query, cands: rank(items, query)}
+		case 7: // Ctrl-G
+			if len(ui.Groups) == 0 {
+				break
+			}
+			group, idx = nextGroup(ui.Groups, group), 0
+			items = filterByGroup(all, group)
+			ranked = rankResult{query: query, cands: rank(items, query)}
+			status = "group: " + cmp.Or(group, "all")
 		case 21: // Ctrl-U
 			query, idx = "", 0
 		case 9: // Tab
@@ -513,8 +1335,7 @@ func interactiveSelect(items []Item) (Item, error) {
 				if b2 == '4' {
 					_, _ = readKey.ReadByte()
 				}
-				cands := filterAndRank(items, query, 30)
-				if len(cands) > 0 {
+				if cands := current(); len(cands) > 0 {
 					idx = len(cands) - 1
 				}
 			case '5':
@@ -528,6 +1349,10 @@ func interactiveSelect(items []Item) (Item, error) {
 					_, _ = readKey.ReadByte()
 				}
 			}
+		case 6: // Ctrl-F
+			idx += fullPage(int(termRows.Load()))
+		case 2: // Ctrl-B
+			idx -= fullPage(int(termRows.Load()))
 		case 14: // Ctrl-N
 			idx++
 		case 16: // Ctrl-P
@@ -537,15 +1362,235 @@ func interactiveSelect(items []Item) (Item, error) {
 				query += string(r)
 			}
 		}
+		if query != ranked.query {
+			debounce.schedule(items, query)
+		}
 		render()
+		mu.Unlock()
+	}
+}
+
+// killFromPicker runs ui.OnKill for the Ctrl-K selection sel and returns the
+// items without the killed session, plus a status line for the picker.
+func killFromPicker(ui UIOptions, all []Item, sel Item) ([]Item, string) {
+	if sel.Kind != KindSession {
+		return all, fmt.Sprintf("%s is not a running session", sel.Name)
+	}
+	if err := ui.OnKill(sel); err != nil {
+		return all, err.Error()
+	}
+	// a copy, since a scheduled ranking may still be reading items
+	all = slices.DeleteFunc(slices.Clone(all), func(it Item) bool { return it.Kind == KindSession && it.Name == sel.Name })
+	return all, "killed " + sel.Name
+}
+
+// queryDebounce is how long the picker query must stay unchanged before
+// the list is re-ranked.
+const queryDebounce = 50 * time.Millisecond
+
+// rankResult is the ranked candidate list for a query.
+type rankResult struct {
+	query string
+	cands []viewItem
+}
+
+// rankDebouncer ranks the last scheduled query once no newer one has
+// arrived for delay and delivers the result on C. Results for superseded
+// queries are dropped rather than queued.
+type rankDebouncer struct {
+	C     chan rankResult
+	delay time.Duration
+	rank  func([]Item, string) []viewItem
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func newRankDebouncer(delay time.Duration, rank func([]Item, string) []viewItem) *rankDebouncer {
+	return &rankDebouncer{C: make(chan rankResult, 1), delay: delay, rank: rank}
+}
+
+// schedule (re)starts the delay for ranking items against query. items must
+// not be modified afterwards.
+func (d *rankDebouncer) schedule(items []Item, query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.delay, func() {
+		res := rankResult{query: query, cands: d.rank(items, query)}
+		for {
+			select {
+			case d.C <- res:
+				return
+			default:
+				select {
+				case <-d.C: // drop an unread older result
+				default:
+				}
+			}
+		}
+	})
+}
+
+func (d *rankDebouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+// sizeSpec is a terminal dimension given as cells ("40") or as a
+// percentage of the available space ("40%").
+type sizeSpec struct {
+	n       int
+	percent bool
+}
+
+func parseSizeSpec(s string) (sizeSpec, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return sizeSpec{}, nil
+	}
+	pct := strings.HasSuffix(s, "%")
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || n <= 0 || (pct && n > 100) {
+		return sizeSpec{}, fmt.Errorf("invalid size %q (want N or N%%)", s)
+	}
+	return sizeSpec{n: n, percent: pct}, nil
+}
+
+// resolve returns the size in cells for a total of avail, or def when unset.
+func (s sizeSpec) resolve(avail, def int) int {
+	switch {
+	case s.n == 0:
+		return def
+	case s.percent:
+		return avail * s.n / 100
+	default:
+		return min(s.n, avail)
 	}
 }
 
-func promptOnce(items []Item) (Item, error) {
+// fullPage is the Ctrl-F/Ctrl-B step on a terminal of the given height: the
+// height minus the header and a spare line, falling back to pageStep when
+// the size is unknown.
+func fullPage(rows int) int {
+	if rows-4 > 0 {
+		return rows - 4
+	}
+	return pageStep
+}
+
+// listHeaderLines is the number of lines above the item list.
+const listHeaderLines = 3
+
+// defaultMaxResults is the max_results default.
+const defaultMaxResults = 30
+
+// resultLimit caps limit to the terminal height minus the header and some
+// spare lines, when the height is known.
+func resultLimit(limit, rows int) int {
+	if avail := rows - 5; avail > 0 {
+		return min(limit, avail)
+	}
+	return limit
+}
+
+// splitLayout divides a rows x cols terminal between the list and the split
+// preview, which defaults to the right half below the header. All widths are
+// 0 when the terminal size is unknown.
+func splitLayout(rows, cols int, ui UIOptions) (listWidth, previewWidth, previewHeight int) {
+	if cols <= 0 {
+		return 0, 0, 0
+	}
+	previewWidth = ui.PreviewWidth.resolve(cols, cols/2)
+	previewHeight = ui.PreviewHeight.resolve(rows-listHeaderLines, rows-listHeaderLines)
+	return cols - previewWidth, previewWidth, previewHeight
+}
+
+// renderList prints the candidate rows; width > 0 clips each row so it
+// stays left of a split preview. A non-empty sep replaces the column padding.
+func renderList(cands []viewItem, idx, width int, ui UIOptions, color bool) {
+	for i, v := range cands {
+		prefix := "  "
+		if i == idx {
+			prefix = glyph("➤ ", "> ")
+		}
+		line := prefix + formatRow(v.Item, ui.Separator)
+		if v.Kind == KindSession && ui.Locked[v.Name] {
+			line += glyph(" 🔒", " [L]")
+		}
+		if width > 0 {
+			line = truncateRunes(line, width-1)
+		}
+		fmt.Println(paint(line, ui.Theme.row(v.Kind, i == idx), color))
+	}
+}
+
+// renderSidePreview draws the preview in its own pass, positioning every
+// line with ANSI cursor moves starting at (row, col).
+func renderSidePreview(sel Item, action PickAction, row, col, width, height int) {
+	lines := append([]string{"--- preview ---"}, previewLines(sel, action)...)
+	if height > 0 && len(lines) > height {
+		lines = lines[:height]
+	}
+	for i, l := range lines {
+		fmt.Printf("\x1b[%d;%dH%s", row+i, col, truncateRunes(l, width))
+	}
+	fmt.Printf("\x1b[%d;1H", row+len(lines))
+}
+
+// formatRow renders kind, name and path as padded columns, or joined by sep.
+func formatRow(it Item, sep string) string {
+	if sep == "" {
+		return fmt.Sprintf("%-3s %-24s %s", it.Kind, it.Name, it.Path)
+	}
+	return string(it.Kind) + sep + it.Name + sep + it.Path
+}
+
+// parseSeparator interprets Go escapes such as \t in a -pick-separator value.
+func parseSeparator(s string) string {
+	if u, err := strconv.Unquote(`"` + s + `"`); err == nil {
+		return u
+	}
+	return s
+}
+
+func previewLines(sel Item, action PickAction) []string {
+	var lines []string
+	switch {
+	case action == ActionKill:
+		lines = append(lines, fmt.Sprintf("Action : kill session \"%s\"", sel.Name))
+	case sel.Kind == KindSession:
+		lines = append(lines, fmt.Sprintf("Action : switch to session \"%s\"", sel.Name))
+	default:
+		lines = append(lines, fmt.Sprintf("Action : new-session -ds %q -c %q; switch/attach", sel.Name, sel.Path))
+	}
+	if sel.Path != "" {
+		lines = append(lines, fmt.Sprintf("Path   : %s", sel.Path))
+	}
+	return lines
+}
+
+func truncateRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+func promptOnce(items []Item, limit int, m MatchOptions) (Item, error) {
 	fmt.Print("Query: ")
 	var q string
 	_, _ = fmt.Scanln(&q)
-	cands := filterAndRank(items, q, 30)
+	cands := filterAndRank(items, q, limit, m)
 	for i, v := range cands {
 		fmt.Printf("%2d) %-3s %-24s %s\n", i+1, v.Kind, v.Name, v.Path)
 	}
@@ -582,23 +1627,112 @@ func enableRawMode() (bool, func(), error) {
 	return true, restore, nil
 }
 
-func clearScreen() { fmt.Print("\x1b[2J\x1b[H") }
+// termSize returns the terminal's rows and columns via `stty size`,
+// or zeros when unknown.
+func termSize() (rows, cols int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, 0
+	}
+	_, _ = fmt.Sscan(string(out), &rows, &cols)
+	return rows, cols
+}
+
+// clearScreen wipes the terminal, or separates redraws with a blank line
+// when the terminal cannot move the cursor.
+func clearScreen() {
+	if !termCaps.CursorMovement {
+		fmt.Println()
+		return
+	}
+	fmt.Print("\x1b[2J\x1b[H")
+}
 
 // ---------------- Orchestrator ----------------
 
+// commandPaths runs a user-supplied shell command and returns each
+// non-empty output line as an expanded path.
+func commandPaths(ctx context.Context, command string) []string {
+	sh, flagC := shellArgv()
+	out, err := shell.Output(ctx, sh, flagC, command)
+	if err != nil {
+		slog.Warn("-cmd failed", "cmd", command, "err", err)
+	}
+	var paths []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if p, ok := expandPath(line); ok {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// listItems returns the candidates for opts: the -recent history, else
+// buildItems, narrowed by -require-clean and -filter-path. Run and
+// -watch-config reloads both list through it.
+func listItems(ctx context.Context, cfg Config, opts Options) ([]Item, error) {
+	var items []Item
+	if opts.Recent > 0 {
+		groups, err := compileGroups(cfg.Groups)
+		if err != nil {
+			return nil, err
+		}
+		hist, _ := loadHistory() // best-effort
+		items = recentItems(hist, listTmuxSessions(ctx), opts.Recent)
+		assignGroups(items, groups)
+	} else {
+		items = buildItems(ctx, cfg)
+	}
+	if opts.RequireClean {
+		if err := requireGit(cfg, "-require-clean"); err != nil {
+			return nil, err
+		}
+		items = cleanRepos(ctx, items)
+	}
+	if len(opts.FilterPaths) > 0 {
+		var err error
+		if items, err = filterByPath(items, opts.FilterPaths); err != nil {
+			return nil, fmt.Errorf("-filter-path: %w", err)
+		}
+	}
+	return items, nil
+}
+
 func buildItems(ctx context.Context, cfg Config) []Item {
 	var items []Item
+	links, _ := loadLinks() // best-effort
 	for _, s := range listTmuxSessions(ctx) {
-		items = append(items, Item{Kind: KindSession, Name: s})
+		items = append(items, Item{Kind: KindSession, Name: s, Path: links[s]})
+	}
+	for _, r := range scanRepos(cfg) {
+		kind := KindGitRepo
+		if _, err := os.Lstat(filepath.Join(r, ".git")); err != nil {
+			kind = KindProject
+		} else if isWorktree(r) {
+			kind = KindWorktree
+		}
+		items = append(items, Item{Kind: kind, Name: sessionNameFromPath(r), Path: r})
 	}
-	for _, r := range scanGitReposConcurrent(cfg) {
-		items = append(items, Item{Kind: KindGitRepo, Name: sessionNameFromPath(r), Path: r})
+	if cfg.ItemCommand != "" {
+		for _, p := range commandPaths(ctx, cfg.ItemCommand) {
+			items = append(items, Item{Kind: KindGitRepo, Name: sessionNameFromPath(p), Path: p})
+		}
 	}
 	for _, b := range cfg.Bookmarks {
 		if p, ok := expandPath(b); ok {
 			items = append(items, Item{Kind: KindBookmark, Name: sessionNameFromPath(p), Path: p})
 		}
 	}
+	if cfg.ScanSSHConfig {
+		items = append(items, sshItems()...)
+	}
 	seen := map[string]struct{}{}
 	var uniq []Item
 	for _, it := range items {
@@ -614,80 +1748,523 @@ func buildItems(ctx context.Context, cfg Config) []Item {
 		seen[key] = struct{}{}
 		uniq = append(uniq, it)
 	}
+	strategy, _ := parseCollisionStrategy(string(cfg.CollisionStrategy)) // Run reports bad values
+	uniq = resolveCollisions(ctx, uniq, strategy)
+	if groups, err := compileGroups(cfg.Groups); err == nil { // Run reports bad globs
+		assignGroups(uniq, groups)
+	}
 	return uniq
 }
 
+// globRegexp compiles a path glob in which * and ? also match "/", so
+// "*/ivuorinen/*" matches anywhere in an absolute path.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("invalid glob %q: unterminated [", glob)
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// filterByPath keeps items whose Path matches any of globs.
+func filterByPath(items []Item, globs []string) ([]Item, error) {
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, g := range globs {
+		re, err := globRegexp(g)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	var out []Item
+	for _, it := range items {
+		if it.Path == "" {
+			continue
+		}
+		p := filepath.ToSlash(it.Path)
+		if slices.ContainsFunc(res, func(re *regexp.Regexp) bool { return re.MatchString(p) }) {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// printItemsJSON writes items to w as a JSON array ([] when empty).
+func printItemsJSON(w io.Writer, items []Item) error {
+	if items == nil {
+		items = []Item{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(items)
+}
+
+// scanStats summarises items as a comment line for -print-stats.
+func scanStats(items []Item, took time.Duration) string {
+	counts := map[ItemKind]int{}
+	for _, it := range items {
+		counts[it.Kind]++
+	}
+	return fmt.Sprintf("# sessions=%d repos=%d projects=%d bookmarks=%d scan_time=%dms",
+		counts[KindSession], counts[KindGitRepo]+counts[KindWorktree], counts[KindProject], counts[KindBookmark], took.Milliseconds())
+}
+
 func Run(opts Options) error {
 	if opts.Print && opts.ConfigPath == "__init__" {
-		return writeDefaultConfig(os.Stdout)
+		return writeDefaultConfig(os.Stdout, "")
 	}
 
-	cfg, err := loadConfig(opts.ConfigPath)
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	if err := validateWindowLayout(cfg.WindowLayout); err != nil {
+		return fmt.Errorf("-window-layout: %w", err)
+	}
+	if opts.MaxResults < 0 || cfg.MaxResults < 0 {
+		return fmt.Errorf("-max/max_results: %d is negative", min(opts.MaxResults, cfg.MaxResults))
+	}
+	if opts.FuzzyThreshold < 0 || opts.FuzzyThreshold > 100 {
+		return fmt.Errorf("-fuzzy-threshold: %d is outside 0-100", opts.FuzzyThreshold)
+	}
+	if opts.Print && opts.PrintJSON {
+		return errors.New("-print and -print-json are mutually exclusive")
+	}
+	theme, err := lookupTheme(opts.ColorScheme)
+	if err != nil {
+		return fmt.Errorf("-color-scheme: %w", err)
+	}
+	if theme, err = cfg.Theme.over(theme); err != nil {
+		return err
+	}
+	match, err := cfg.matchOptions()
 	if err != nil {
-		return fmt.Errorf("%s: config error: %w", appName, err)
+		return err
+	}
+	if _, err := compileGroups(cfg.Groups); err != nil {
+		return err
+	}
+	if _, err := parseCollisionStrategy(string(cfg.CollisionStrategy)); err != nil {
+		return err
+	}
+	opts.Group = strings.ToLower(opts.Group) // viper lowercases map keys
+	if _, ok := cfg.Groups[opts.Group]; opts.Group != "" && !ok {
+		return fmt.Errorf("-group: no group %q in the config", opts.Group)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
 	defer cancel()
 
-	items := buildItems(ctx, cfg)
+	if cfg.SessionIdleTimeout < 0 {
+		return fmt.Errorf("session_idle_timeout: %s is negative", cfg.SessionIdleTimeout)
+	}
+	if cfg.SessionIdleTimeout > 0 && !opts.Print && !opts.PrintJSON && opts.StartupLayout == "" && opts.InputFile == "" {
+		killIdleSessions(ctx, cfg.SessionIdleTimeout, time.Now())
+	}
+	if opts.StartupLayout != "" {
+		if !shell.IsAvailable("tmux") {
+			return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+		}
+		return runStartupLayout(ctx, cfg, opts.StartupLayout)
+	}
+	if opts.InputFile != "" {
+		if !shell.IsAvailable("tmux") {
+			return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+		}
+		return runInputFile(opts.timeout(), cfg, opts.InputFile, opts.NoAttach)
+	}
+
+	started := time.Now()
+	items, err := listItems(ctx, cfg, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Print || opts.PrintJSON {
+		items = filterByGroup(items, opts.Group)
+	}
 	if opts.Print {
 		for _, it := range items {
 			fmt.Printf("%s\t%s\t%s\n", it.Kind, it.Name, it.Path)
 		}
+		if opts.PrintStats {
+			fmt.Println(scanStats(items, time.Since(started)))
+		}
 		return nil
 	}
+	if opts.PrintJSON {
+		return printItemsJSON(os.Stdout, items)
+	}
 	if len(items) == 0 {
 		return errors.New("no candidates")
 	}
+	if !opts.Clipboard && !opts.Select && opts.OpenRemote == "" && !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
 
-	selected, err := interactiveSelect(items)
+	ui := UIOptions{
+		SplitPreview:   cfg.SplitPreview,
+		Separator:      parseSeparator(opts.PickSeparator),
+		FuzzyThreshold: opts.FuzzyThreshold,
+		Theme:          theme,
+		Match:          match,
+		MaxResults:     cfg.MaxResults,
+		Locked:         lockedSessions(ctx),
+		Groups:         slices.Sorted(maps.Keys(cfg.Groups)),
+		Group:          opts.Group,
+	}
+	if ui.Action, err = parsePickAction(opts.PickAction); err != nil {
+		return err
+	}
+	if len(filterByGroup(filterForAction(items, ui.Action), ui.Group)) == 0 {
+		return fmt.Errorf("no candidates for action %s", ui.Action)
+	}
+	if ui.PreviewWidth, err = parseSizeSpec(opts.PreviewWidth); err != nil {
+		return fmt.Errorf("-preview-width: %w", err)
+	}
+	if ui.PreviewHeight, err = parseSizeSpec(opts.PreviewHeight); err != nil {
+		return fmt.Errorf("-preview-height: %w", err)
+	}
+	if !opts.Select && !opts.Clipboard && opts.OpenRemote == "" {
+		ui.OnKill = func(it Item) error {
+			kctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+			defer cancel()
+			return killSession(kctx, it.Name)
+		}
+	}
+	if path := resolveConfigFile(opts.ConfigPath); opts.WatchConfig && path != "" {
+		wctx, stop := context.WithCancel(context.Background())
+		defer stop()
+		ui.Reload = watchItems(wctx, opts, path)
+	}
+	if opts.Select {
+		return selectToStdout(items, ui)
+	}
+	selected, err := interactiveSelect(items, ui)
 	if err != nil {
 		return err
 	}
+	// The picker may have been open for longer than the timeout.
+	ctx, cancel = context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if opts.Clipboard {
+		return copySelection(ctx, selected, opts.ClipboardName)
+	}
+	if opts.OpenRemote != "" {
+		return openRemoteURL(ctx, cfg, selected, opts.OpenRemote)
+	}
+	if ui.Action == ActionKill {
+		return killSession(ctx, selected.Name)
+	}
+	if selected.Kind != KindSession {
+		if name := sessionNameFromEnv(opts.SessionNameEnv); name != "" {
+			selected.Name = name
+		}
+	}
+	if opts.NoAttach {
+		return createDetached(ctx, cfg, selected)
+	}
+	return openSelected(ctx, cfg, selected, opts.DetachCurrent)
+}
+
+// openSelected switches to (creating if needed) the session for selected and
+// records it in the history. With detachCurrent, clients of the session the
+// user came from are detached afterwards.
+func openSelected(ctx context.Context, cfg Config, selected Item, detachCurrent bool) error {
+	var err error
 	inTmux := isInTmux()
+	origin := ""
+	if detachCurrent && inTmux {
+		origin = currentSession(ctx) // must be read before switching away
+	}
 	switch selected.Kind {
 	case KindSession:
-		return switchToSession(ctx, selected.Name, inTmux)
-	case KindGitRepo, KindBookmark:
-		return createOrSwitchForDir(ctx, selected.Name, selected.Path, inTmux)
+		err = switchToSession(ctx, cfg, selected.Name, inTmux)
+	case KindGitRepo, KindWorktree, KindProject, KindBookmark:
+		selected.Name, err = createOrSwitchForDir(ctx, cfg, selected.Name, selected.Path, inTmux)
 	default:
 		return nil
 	}
+	if err != nil {
+		return err
+	}
+	if _, dry := shell.(dryRunShell); !dry { // a dry run switched nowhere
+		if err := appendHistory(selected); err != nil {
+			slog.Debug("history not recorded", "err", err)
+		}
+	}
+	if origin == "" || origin == selected.Name {
+		return nil
+	}
+	return shell.Run(ctx, "tmux", "detach-client", "-s", origin)
+}
+
+// selectToStdout runs the picker on the terminal and prints the selected
+// item's path (or session name) to stdout, so it works inside $(...).
+func selectToStdout(items []Item, ui UIOptions) error {
+	out := os.Stdout
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		os.Stdout = tty // the picker draws with fmt.Print*
+		defer func() {
+			os.Stdout = out
+			_ = tty.Close()
+		}()
+	}
+	selected, err := interactiveSelect(items, ui)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, selectionText(selected))
+	return nil
+}
+
+func selectionText(it Item) string {
+	if it.Path != "" {
+		return it.Path
+	}
+	return it.Name
+}
+
+// sessionNameFromEnv returns the sanitized value of $envVar, or "" when the
+// variable is unset, empty or has no usable characters.
+func sessionNameFromEnv(envVar string) string {
+	if envVar == "" {
+		return ""
+	}
+	return sanitizeRaw(os.Getenv(envVar))
+}
+
+// createDetached makes sure a session exists for it without switching the
+// client to it.
+func createDetached(ctx context.Context, cfg Config, it Item) error {
+	created := false
+	if it.Kind != KindSession {
+		var err error
+		if it.Name, created, err = createSessionForDir(ctx, cfg, it.Name, it.Path); err != nil {
+			return err
+		}
+	}
+	if created {
+		fmt.Printf("Created session %s\n", it.Name)
+	} else {
+		fmt.Printf("Session %s already exists\n", it.Name)
+	}
+	return nil
 }
 
 // ---------------- main() ----------------
 
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 func main() {
 	var (
 		flagCfg     string
 		flagPrint   bool
 		flagInitCfg bool
 		flagVersion bool
+		flagClip    bool
+		flagDetach  bool
+		flagExample bool
+		flagNoGit   bool
+		flagWatch   bool
+		flagFollow  bool
+		flagItemCmd string
+		flagPrevW   string
+		flagPrevH   string
+		flagAction  string
+		flagStats   bool
+		flagNoAtt   bool
+		flagRecent  int
+		flagNameEnv string
+		flagSep     string
+		flagFilter  stringList
+		flagGroup   string
+		flagLayout  string
+		flagSelect  bool
+		flagKill    bool
+		flagStartup string
+		flagInput   string
+		flagClean   bool
+		flagThresh  int
+		flagNoCache bool
+		flagRefresh bool
+		flagScanPar int
+		flagIdle    time.Duration
+		flagTimeout time.Duration
+		flagMax     int
+		flagNameLen int
+		flagScheme  string
+		flagJSON    bool
+		flagTmuxArg string
+		flagDryRun  bool
+		flagFormat  string
+		flagLogLvl  string
+		flagLogFmt  string
 	)
 	flag.StringVar(&flagCfg, "config", "", "Explicit config file path")
 	flag.BoolVar(&flagPrint, "print", false, "Print candidates and exit")
+	flag.BoolVar(&flagJSON, "print-json", false, "Print candidates as a JSON array of {kind, name, path} and exit")
 	flag.BoolVar(&flagInitCfg, "init-config", false, "Write default config to XDG path and exit")
+	flag.StringVar(&flagFormat, "format", "yaml", "With -init-config, the config format: yaml, toml or json")
+	flag.BoolVar(&flagExample, "with-examples", false, "With -init-config, also write a documented config.example.yaml")
+	flag.BoolVar(&flagNoGit, "no-git", false, "Never run git; discover repos by directory markers only")
+	flag.BoolVar(&flagWatch, "watch-config", false, "Reload the config and candidate list when the config file changes")
+	flag.BoolVar(&flagFollow, "follow-symlinks", false, "Descend into symlinked directories while scanning")
+	flag.IntVar(&flagScanPar, "max-scan-concurrency", 0, "Walk at most N scan paths at once (default max_scan_concurrency or the number of CPUs)")
+	flag.DurationVar(&flagTimeout, "timeout", 0, "Time limit for the tmux and git calls of this run, e.g. 30s (default timeout or "+defaultTimeout.String()+")")
+	flag.DurationVar(&flagIdle, "session-idle-timeout", 0, "Before showing the picker, kill detached sessions last attached longer ago than this (e.g. 2h)")
+	flag.BoolVar(&flagNoCache, "no-cache", false, "Scan without reading or writing the scan cache")
+	flag.BoolVar(&flagRefresh, "refresh-cache", false, "Re-walk every scan path and rewrite the scan cache")
+	flag.StringVar(&flagItemCmd, "cmd", "", "Shell command whose output (one path per line) adds items")
+	flag.StringVar(&flagPrevW, "preview-width", "", "Split preview width in columns or percent (e.g. 40 or 40%)")
+	flag.StringVar(&flagPrevH, "preview-height", "", "Split preview height in lines or percent")
+	flag.StringVar(&flagAction, "pick-action", "create", "What Enter does: create, switch or kill")
+	flag.BoolVar(&flagStats, "print-stats", false, "With -print, append scan statistics as a comment line")
+	flag.BoolVar(&flagNoAtt, "no-attach", false, "Create the selected session detached without switching to it")
+	flag.IntVar(&flagNameLen, "session-name-max-len", 0, "Shorten derived session names to at most N characters, ending in ...")
+	flag.StringVar(&flagNameEnv, "session-name-from-env", "", "Name new sessions after the value of this environment variable when it is set")
+	flag.StringVar(&flagSep, "pick-separator", "", `Delimiter between kind, name and path in picker rows (e.g. "\t" or " | ")`)
+	flag.Var(&flagFilter, "filter-path", "Only list items whose path matches this glob (repeatable; * matches across /)")
+	flag.StringVar(&flagGroup, "group", "", "Only list items in this groups label (the picker starts on it; Ctrl-G cycles)")
+	flag.StringVar(&flagLayout, "window-layout", "", "tmux layout for newly created sessions: "+strings.Join(tmuxLayouts, ", "))
+	flag.StringVar(&flagStartup, "startup-layout", "", "Create the sessions listed in this YAML file, then attach to the first")
+	flag.StringVar(&flagInput, "input-file", "", "Create a session for each path in this file (one per line, # comments), then attach to the first unless -no-attach")
+	flag.BoolVar(&flagClean, "require-clean", false, "Only list repos whose `git status --porcelain` is empty")
+	flag.StringVar(&flagScheme, "color-scheme", defaultColorScheme, "Picker colours: "+strings.Join(slices.Sorted(maps.Keys(themes)), ", "))
+	flag.IntVar(&flagMax, "max", 0, "Show at most N candidates (default max_results or 30; the terminal height also caps it)")
+	flag.IntVar(&flagThresh, "fuzzy-threshold", 0, "Hide matches scoring below this percentage (0-100) of the best match")
+	flag.BoolVar(&flagKill, "kill", false, "Kill the selected session instead of switching (same as -pick-action kill)")
+	flag.BoolVar(&flagSelect, "select", false, "Print the selected item's path (or session name) instead of switching")
+	flag.IntVar(&flagRecent, "recent", 0, "Only list the N most recently used items from history (skips scanning)")
+	flag.StringVar(&flagLogLvl, "log-level", "", "Log level: debug, info, warn or error (default $TSM_LOG_LEVEL or info)")
+	flag.StringVar(&flagLogFmt, "log-format", "text", "Log format: text or json")
+	flag.StringVar(&flagTmuxArg, "tmux-args", "", `Extra arguments put before every tmux command, shell-quoted (e.g. "-L work")`)
+	flag.BoolVar(&flagDryRun, "dry-run", false, "Print the tmux and hook commands tsm would run instead of running them")
 	flag.BoolVar(&flagVersion, "version", false, "Print version and exit")
+	flag.BoolVar(&flagClip, "clipboard", false, "Copy the selected item's path to the clipboard instead of switching")
+	flag.BoolVar(&flagDetach, "detach-current-session", false, "After switching, detach clients from the previous session")
 	flag.Parse()
 
+	if err := setupLogging(os.Stderr, flagLogLvl, flagLogFmt); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	termCaps = detectTermCapabilities(os.Getenv("TERM"), os.Getenv("TERM_PROGRAM"))
+
+	if flagTmuxArg != "" {
+		words, err := splitShellWords(flagTmuxArg)
+		if err != nil {
+			logError("invalid -tmux-args", err)
+			os.Exit(2)
+		}
+		shell = execShell{TmuxArgs: words}
+	}
+	if flagDryRun {
+		shell = dryRunShell{inner: shell, w: os.Stdout}
+	}
+	if flagTimeout < 0 {
+		logError("invalid -timeout", fmt.Errorf("%s is negative", flagTimeout))
+		os.Exit(2)
+	}
+
 	if flagVersion {
 		fmt.Printf("tsm %s (commit %s, built %s)\n", version, commit, date)
 		return
 	}
 
 	if flagInitCfg {
-		if err := writeDefaultConfig(os.Stdout); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+		if err := initConfig(os.Stdout, flagFormat, flagExample); err != nil {
+			logError("init-config failed", err)
 			os.Exit(1)
 		}
 		return
 	}
 
-	if err := Run(Options{
-		ConfigPath: flagCfg,
-		Print:      flagPrint,
-	}); err != nil && err.Error() != "cancelled" {
-		fmt.Fprintln(os.Stderr, err)
+	opts := Options{
+		ConfigPath:         flagCfg,
+		Timeout:            resolveTimeout(flagTimeout, flagCfg),
+		Print:              flagPrint,
+		Clipboard:          flagClip,
+		DetachCurrent:      flagDetach,
+		NoGit:              flagNoGit,
+		WatchConfig:        flagWatch,
+		FollowSymlinks:     flagFollow,
+		ItemCommand:        flagItemCmd,
+		PreviewWidth:       flagPrevW,
+		PreviewHeight:      flagPrevH,
+		PickAction:         flagAction,
+		PrintStats:         flagStats,
+		NoAttach:           flagNoAtt,
+		Recent:             flagRecent,
+		SessionNameEnv:     flagNameEnv,
+		PickSeparator:      flagSep,
+		FilterPaths:        flagFilter,
+		Group:              flagGroup,
+		WindowLayout:       flagLayout,
+		Select:             flagSelect,
+		StartupLayout:      flagStartup,
+		InputFile:          flagInput,
+		RequireClean:       flagClean,
+		FuzzyThreshold:     flagThresh,
+		NoCache:            flagNoCache,
+		MaxScanConcurrency: flagScanPar,
+		SessionIdleTimeout: flagIdle,
+		MaxResults:         flagMax,
+		SessionNameMaxLen:  flagNameLen,
+		ColorScheme:        flagScheme,
+		PrintJSON:          flagJSON,
+		RefreshCache:       flagRefresh,
+	}
+	if flagKill {
+		opts.PickAction = string(ActionKill)
+	}
+
+	cmd, args, ok, err := resolveCommand(flag.Args(), flag.NFlag())
+	if err != nil {
+		logError("invalid command", err)
+		os.Exit(2)
+	}
+	if ok {
+		if err := cmd.Run(opts, args); err != nil {
+			var st exitStatus
+			if errors.As(err, &st) {
+				os.Exit(int(st))
+			}
+			logError(appName+" "+cmd.Name+" failed", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := Run(opts); err != nil && !errors.Is(err, ErrCancelled) {
+		logError(appName+" failed", err)
 	}
 }
@@ -1,35 +1,63 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/spf13/viper"
 )
 
 type fakeShell struct {
-	out map[string][]byte
-	err map[string]error
+	out   map[string][]byte
+	err   map[string]error
+	avail map[string]bool // nil means every binary is available
+	calls []string        // every command run, as k(name, args...)
+	mu    sync.Mutex      // guards calls for concurrent callers
 }
 
 func k(name string, args ...string) string { return name + " " + strings.Join(args, " ") }
+func (f *fakeShell) record(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, key)
+}
 func (f *fakeShell) Output(_ context.Context, name string, args ...string) ([]byte, error) {
+	f.record(k(name, args...))
 	return f.out[k(name, args...)], f.err[k(name, args...)]
 }
 func (f *fakeShell) Run(_ context.Context, name string, args ...string) error {
+	f.record(k(name, args...))
 	return f.err[k(name, args...)]
 }
+func (f *fakeShell) IsAvailable(name string) bool {
+	return f.avail == nil || f.avail[name]
+}
 
 func TestSessionNameFromPath(t *testing.T) {
 	cases := map[string]string{
-		"/a/b":            "a_b",
-		"/x/y/z":          "y_z",
-		"/weird/äö!/n":    "weird_n",
-		"/single":         "single",
-		"/a/.hidden":      "a_.hidden",
+		"/a/b":         "a_b",
+		"/x/y/z":       "y_z",
+		"/weird/äö!/n": "weird_n",
+		"/single":      "single",
+		"/a/.hidden":   "a_.hidden",
 	}
 	for in, want := range cases {
 		got := sessionNameFromPath(in)
@@ -45,7 +73,7 @@ func TestFuzzyScoreAndFilter(t *testing.T) {
 		{Kind: KindGitRepo, Name: "test_a", Path: "/Code/test/a"},
 		{Kind: KindSession, Name: "util"},
 	}
-	got := filterAndRank(items, "a", 10)
+	got := filterAndRank(items, "a", 10, MatchOptions{})
 	if len(got) < 2 {
 		t.Fatalf("expected 2+ matches, got %d", len(got))
 	}
@@ -68,16 +96,27 @@ func TestScanGitReposConcurrent(t *testing.T) {
 	}
 }
 
+func TestScanWalkMissingRoot(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "nope")
+	for _, follow := range []bool{false, true} {
+		s := newRepoScanner(Config{ScanPaths: []string{missing}, FollowSymlinks: follow})
+		err := s.walk(missing, func(string) {})
+		if !errors.Is(err, ErrScanFailed) {
+			t.Fatalf("follow=%v: expected ErrScanFailed, got %v", follow, err)
+		}
+	}
+}
+
 func TestCreateOrSwitchForDir(t *testing.T) {
 	// swap global shell with fake
 	old := shell
 	f := &fakeShell{
 		out: map[string][]byte{},
 		err: map[string]error{
-			k("tmux", "has-session", "-t", "ivuorinen_a"):                   errors.New("no"),
+			k("tmux", "has-session", "-t", "ivuorinen_a"):                             errors.New("no"),
 			k("tmux", "new-session", "-ds", "ivuorinen_a", "-c", "/Code/ivuorinen/a"): nil,
-			k("tmux", "switch-client", "-t", "ivuorinen_a"):                  nil,
-			k("tmux", "attach", "-t", "ivuorinen_a"):                         nil,
+			k("tmux", "switch-client", "-t", "ivuorinen_a"):                           nil,
+			k("tmux", "attach", "-t", "ivuorinen_a"):                                  nil,
 		},
 	}
 	shell = f
@@ -86,10 +125,3346 @@ func TestCreateOrSwitchForDir(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	if err := createOrSwitchForDir(ctx, "ivuorinen_a", "/Code/ivuorinen/a", true); err != nil {
+	if _, err := createOrSwitchForDir(ctx, Config{}, "ivuorinen_a", "/Code/ivuorinen/a", true); err != nil {
 		t.Fatalf("inside tmux path switch failed: %v", err)
 	}
-	if err := createOrSwitchForDir(ctx, "ivuorinen_a", "/Code/ivuorinen/a", false); err != nil {
+	if _, err := createOrSwitchForDir(ctx, Config{}, "ivuorinen_a", "/Code/ivuorinen/a", false); err != nil {
 		t.Fatalf("outside tmux path switch failed: %v", err)
 	}
 }
+
+func TestOpenSelectedDetachCurrent(t *testing.T) {
+	t.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	old := shell
+	defer func() { shell = old }()
+	ctx := context.Background()
+
+	f := &fakeShell{out: map[string][]byte{k("tmux", "display-message", "-p", "#S"): []byte("old\n")}}
+	shell = f
+	if err := openSelected(ctx, Config{}, Item{Kind: KindSession, Name: "new"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if last := f.calls[len(f.calls)-1]; last != k("tmux", "detach-client", "-s", "old") {
+		t.Fatalf("expected old session detached last, got %v", f.calls)
+	}
+
+	f = &fakeShell{out: map[string][]byte{k("tmux", "display-message", "-p", "#S"): []byte("new\n")}}
+	shell = f
+	if err := openSelected(ctx, Config{}, Item{Kind: KindSession, Name: "new"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(f.calls, k("tmux", "detach-client", "-s", "new")) {
+		t.Fatalf("detached the session just switched to: %v", f.calls)
+	}
+
+	f = &fakeShell{}
+	shell = f
+	if err := openSelected(ctx, Config{}, Item{Kind: KindSession, Name: "new"}, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range f.calls {
+		if strings.HasPrefix(c, "tmux detach-client") || strings.HasPrefix(c, "tmux display-message") {
+			t.Fatalf("unexpected %q without -detach-current-session", c)
+		}
+	}
+}
+
+func TestResolveCommand(t *testing.T) {
+	t.Setenv("TSM_DEFAULT_COMMAND", "")
+	if _, _, ok, err := resolveCommand(nil, 0); ok || err != nil {
+		t.Fatalf("bare tsm without default: ok=%v err=%v", ok, err)
+	}
+
+	t.Setenv("TSM_DEFAULT_COMMAND", "version")
+	c, _, ok, err := resolveCommand(nil, 0)
+	if err != nil || !ok || c.Name != "version" {
+		t.Fatalf("default command not used: %+v ok=%v err=%v", c, ok, err)
+	}
+
+	t.Setenv("TSM_DEFAULT_COMMAND", "nope")
+	c, rest, ok, err := resolveCommand([]string{"version", "x"}, 0)
+	if err != nil || !ok || c.Name != "version" || len(rest) != 1 {
+		t.Fatalf("explicit command should win: %+v rest=%v ok=%v err=%v", c, rest, ok, err)
+	}
+	if _, _, _, err := resolveCommand(nil, 0); err == nil {
+		t.Fatal("expected error for unknown default command")
+	}
+	// flag-only runs such as `tsm -print` keep the picker flow
+	if _, _, ok, err := resolveCommand(nil, 1); ok || err != nil {
+		t.Fatalf("default command used with flags: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestListTmuxSessionsWithoutTmux(t *testing.T) {
+	old := shell
+	shell = &fakeShell{
+		out:   map[string][]byte{k("tmux", "list-sessions", "-F", "#S"): []byte("a\nb\n")},
+		avail: map[string]bool{"tmux": false},
+	}
+	defer func() { shell = old }()
+
+	if got := listTmuxSessions(context.Background()); got != nil {
+		t.Fatalf("expected no sessions when tmux is unavailable, got %v", got)
+	}
+	shell = &fakeShell{out: map[string][]byte{k("tmux", "list-sessions", "-F", "#S"): []byte("b\na\n")}}
+	if got := listTmuxSessions(context.Background()); len(got) != 2 || got[0] != "a" {
+		t.Fatalf("unexpected sessions: %v", got)
+	}
+}
+
+func TestLinkedSessionsGetPath(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if err := saveLinks(Links{"scratch": "/tmp/scratch"}); err != nil {
+		t.Fatal(err)
+	}
+	old := shell
+	shell = &fakeShell{out: map[string][]byte{k("tmux", "list-sessions", "-F", "#S"): []byte("scratch\nother\n")}}
+	defer func() { shell = old }()
+
+	items := buildItems(context.Background(), Config{})
+	paths := map[string]string{}
+	for _, it := range items {
+		paths[it.Name] = it.Path
+	}
+	if paths["scratch"] != "/tmp/scratch" || paths["other"] != "" {
+		t.Fatalf("unexpected linked paths: %v", paths)
+	}
+}
+
+func TestLoadConfigExplicitMissing(t *testing.T) {
+	_, err := loadConfig(filepath.Join(t.TempDir(), "nope.yaml"))
+	if !errors.Is(err, ErrConfigNotFound) {
+		t.Fatalf("expected ErrConfigNotFound, got %v", err)
+	}
+	if errorHint(err) == "" {
+		t.Fatal("expected a hint for ErrConfigNotFound")
+	}
+}
+
+func TestClipboardCommand(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("linux tool selection only")
+	}
+	t.Setenv("WAYLAND_DISPLAY", "")
+	old := shell
+	defer func() { shell = old }()
+
+	shell = &fakeShell{avail: map[string]bool{"xclip": true, "wl-copy": true}}
+	name, args, err := clipboardCommand()
+	if err != nil || name != "xclip" || len(args) != 2 {
+		t.Fatalf("got %s %v %v", name, args, err)
+	}
+	shell = &fakeShell{avail: map[string]bool{}}
+	if _, _, err := clipboardCommand(); err == nil {
+		t.Fatal("expected error when no clipboard tool is available")
+	}
+}
+
+func TestLoadConfigYAMLAnchors(t *testing.T) {
+	cfg, err := loadConfig(filepath.Join("testdata", "anchors.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ScanPaths) != 2 || cfg.ScanPaths[1] != "/srv/work" {
+		t.Fatalf("scan_paths alias not resolved: %v", cfg.ScanPaths)
+	}
+	if len(cfg.Bookmarks) != 2 {
+		t.Fatalf("bookmarks alias not resolved: %v", cfg.Bookmarks)
+	}
+	if cfg.MaxDepth != 5 {
+		t.Fatalf("merge key not applied: max_depth=%d", cfg.MaxDepth)
+	}
+}
+
+func TestRenameWindow(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{
+		out: map[string][]byte{
+			k("tmux", "list-windows", "-t", "proj", "-F", "#{window_index}\t#{window_name}\t#{@tsm-pinned}"): []byte("0\tMain\n1\tlogs\n"),
+		},
+		err: map[string]error{
+			k("tmux", "has-session", "-t", "gone"):                 errors.New("no"),
+			k("tmux", "rename-window", "-t", "proj:0", "main-old"): nil,
+		},
+	}
+
+	ctx := context.Background()
+	if got, err := resolveWindow(ctx, "proj", "main"); err != nil || got != "proj:0" {
+		t.Fatalf("case-insensitive lookup: %q %v", got, err)
+	}
+	if got, _ := resolveWindow(ctx, "proj", "3"); got != "proj:3" {
+		t.Fatalf("index lookup: %q", got)
+	}
+	if _, err := resolveWindow(ctx, "proj", "nope"); err == nil {
+		t.Fatal("expected error for unknown window")
+	}
+	if err := runRenameWindow(Options{}, []string{"proj", "MAIN", "main-old"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runRenameWindow(Options{}, []string{"gone", "main", "x"}); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("expected ErrNoSession, got %v", err)
+	}
+}
+
+func TestBackupConfigPrunes(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	cfgPath := filepath.Join(xdg, "tsm", "config.yaml")
+	_ = os.MkdirAll(filepath.Dir(cfgPath), 0o755)
+	if err := os.WriteFile(cfgPath, []byte("max_depth: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for range 4 {
+		if _, err := backupConfig(cfgPath, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 kept backups, got %d: %v", len(all), all)
+	}
+	if dst, err := backupConfig(filepath.Join(xdg, "missing.yaml"), 2); dst != "" || err != nil {
+		t.Fatalf("missing config should be a no-op, got %q %v", dst, err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("/tmp/it's here"); got != `'/tmp/it'\''s here'` {
+		t.Fatalf("shellQuote: %s", got)
+	}
+}
+
+func TestExampleConfigDocumentsEveryKey(t *testing.T) {
+	ct := reflect.TypeFor[Config]()
+	for i := range ct.NumField() {
+		tag := ct.Field(i).Tag.Get("mapstructure")
+		if _, ok := configDocs[tag]; tag != "" && tag != "-" && !ok {
+			t.Fatalf("config key %q has no entry in configDocs", tag)
+		}
+	}
+	ex := string(exampleConfig())
+	for key := range configDocs {
+		if !strings.Contains(ex, "\n"+key+": ") {
+			t.Fatalf("example config missing %q", key)
+		}
+	}
+	// the example must itself be a loadable config
+	p := filepath.Join(t.TempDir(), "config.example.yaml")
+	if err := os.WriteFile(p, []byte(ex), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxDepth != 3 || len(cfg.Exclude) != len(defaultExclude()) {
+		t.Fatalf("unexpected example config values: %+v", cfg)
+	}
+}
+
+func TestFindItem(t *testing.T) {
+	items := []Item{
+		{Kind: KindSession, Name: "ivuorinen_a"},
+		{Kind: KindGitRepo, Name: "ivuorinen_a", Path: "/Code/ivuorinen/a"},
+		{Kind: KindBookmark, Name: "home_dots", Path: "/home/dots"},
+	}
+	if it, ok := findItem(items, "ivuorinen_a", true, MatchOptions{}); !ok || it.Path != "/Code/ivuorinen/a" {
+		t.Fatalf("exact match should prefer the item with a path: %+v", it)
+	}
+	if _, ok := findItem(items, "home", true, MatchOptions{}); ok {
+		t.Fatal("exact lookup should not fall back to prefix")
+	}
+	if it, ok := findItem(items, "home", false, MatchOptions{}); !ok || it.Name != "home_dots" {
+		t.Fatalf("prefix match: %+v", it)
+	}
+	if it, ok := findItem(items, "hdts", false, MatchOptions{}); !ok || it.Name != "home_dots" {
+		t.Fatalf("fuzzy match: %+v", it)
+	}
+	if it, ok := findItem(items, "hdts", false, MatchOptions{Mode: FuzzyModeExact}); ok {
+		t.Fatalf("fuzzy_mode exact should not match a subsequence: %+v", it)
+	}
+	if it, ok := findItem(items, "Dots", false, MatchOptions{Mode: FuzzyModeExact, CaseSensitive: true}); ok {
+		t.Fatalf("case_sensitive should not match a different case: %+v", it)
+	}
+}
+
+func TestWatchConfigDetectsChange(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(p, []byte("max_depth: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go watchConfig(ctx, p, 10*time.Millisecond, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(p, []byte("max_depth: 22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("change not detected")
+	}
+}
+
+func TestWatchItemsKeepsListOptions(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	old := shell
+	defer func() { shell = old }()
+	root := t.TempDir()
+	work, home := filepath.Join(root, "work", "a"), filepath.Join(root, "home", "b")
+	shell = &fakeShell{avail: map[string]bool{"git": true}, out: map[string][]byte{
+		k("git", "-C", work, "status", "--porcelain"): []byte(" M main.go\n"),
+	}}
+	for _, d := range []string{work, home} {
+		if err := os.MkdirAll(filepath.Join(d, ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := appendHistory(Item{Kind: KindGitRepo, Name: "home_b", Path: home}); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(depth int) {
+		t.Helper()
+		data := fmt.Sprintf("scan_paths: [%s]\nmax_depth: %d\n", strconv.Quote(root), depth)
+		if err := os.WriteFile(conf, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchers := map[string]struct {
+		opts Options
+		want string
+	}{
+		"-filter-path":   {Options{FilterPaths: []string{"*/work/*"}}, work},
+		"-recent":        {Options{Recent: 1}, home},
+		"-require-clean": {Options{RequireClean: true}, home},
+	}
+	reloads := map[string]<-chan []Item{}
+	for name, w := range watchers {
+		w.opts.ConfigPath, w.opts.NoCache = conf, true
+		reloads[name] = watchItems(ctx, w.opts, conf)
+	}
+	time.Sleep(100 * time.Millisecond) // let the watchers record the first stamp
+	write(4)
+	for name, ch := range reloads {
+		want := watchers[name].want
+		select {
+		case items := <-ch:
+			if len(items) != 1 || items[0].Path != want {
+				t.Errorf("%s reload listed %+v, want only %s", name, items, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no reload", name)
+		}
+	}
+}
+
+func TestLocateConfigFile(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	if p, _ := locateConfigFile(""); p != "" {
+		t.Fatalf("expected no config, got %q", p)
+	}
+	want := filepath.Join(xdg, "tsm", "config.yaml")
+	_ = os.MkdirAll(filepath.Dir(want), 0o755)
+	_ = os.WriteFile(want, []byte("max_depth: 2\n"), 0o644)
+	if p, src := locateConfigFile(""); p != want || src != "XDG_CONFIG_HOME" {
+		t.Fatalf("got %q from %q", p, src)
+	}
+	if p, src := locateConfigFile("/etc/tsm.yaml"); p != "/etc/tsm.yaml" || src != "-config flag" {
+		t.Fatalf("got %q from %q", p, src)
+	}
+}
+
+func TestScanFollowSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	other := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(other, "linked", ".git"), 0o755)
+	if err := os.Symlink(other, filepath.Join(tmp, "elsewhere")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	// circular link back to the root must not loop forever
+	_ = os.Symlink(tmp, filepath.Join(other, "back"))
+
+	cfg := Config{ScanPaths: []string{tmp}, Exclude: defaultExclude(), MaxDepth: 10}
+	if repos := scanGitReposConcurrent(cfg); len(repos) != 0 {
+		t.Fatalf("symlinks followed without follow_symlinks: %v", repos)
+	}
+	cfg.FollowSymlinks = true
+	repos := scanGitReposConcurrent(cfg)
+	if len(repos) != 1 || repos[0] != filepath.Join(tmp, "elsewhere", "linked") {
+		t.Fatalf("unexpected repos: %v", repos)
+	}
+
+	// skipping a symlinked directory must not skip the siblings after it
+	_ = os.Symlink(other, filepath.Join(tmp, "node_modules"))
+	_ = os.MkdirAll(filepath.Join(tmp, "zz", ".git"), 0o755)
+	repos = scanGitReposConcurrent(cfg)
+	if !slices.Contains(repos, filepath.Join(tmp, "zz")) {
+		t.Fatalf("sibling after an excluded symlink was skipped: %v", repos)
+	}
+}
+
+func TestFormatAgeAndParseDuration(t *testing.T) {
+	d := 3*24*time.Hour + 14*time.Hour + 27*time.Minute + 10*time.Second
+	if got := formatAge(d); got != "3d 14h 27m" {
+		t.Fatalf("formatAge=%q", got)
+	}
+	if got := formatAge(90 * time.Second); got != "1m" {
+		t.Fatalf("formatAge=%q", got)
+	}
+	for in, want := range map[string]time.Duration{
+		"2h":    2 * time.Hour,
+		"3d":    72 * time.Hour,
+		"1d12h": 36 * time.Hour,
+	} {
+		if got, err := parseDuration(in); err != nil || got != want {
+			t.Fatalf("parseDuration(%q)=%v,%v want %v", in, got, err, want)
+		}
+	}
+}
+
+func TestBuildItemsFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh only")
+	}
+	old := shell
+	shell = &fakeShell{out: map[string][]byte{
+		k("sh", "-c", "list-projects"): []byte("/srv/code/alpha\n\n/srv/code/beta\n"),
+	}, avail: map[string]bool{}}
+	defer func() { shell = old }()
+
+	items := buildItems(context.Background(), Config{ItemCommand: "list-projects"})
+	if len(items) != 2 || items[0].Name != "code_alpha" || items[1].Path != "/srv/code/beta" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
+
+func TestPaneTargetAndTitle(t *testing.T) {
+	for want, parts := range map[string][]string{
+		"":      nil,
+		"s:":    {"s"},
+		"s:w":   {"s", "w"},
+		"s:w.2": {"s", "w", "2"},
+	} {
+		if got := paneTarget(parts); got != want {
+			t.Fatalf("paneTarget(%v)=%q want %q", parts, got, want)
+		}
+	}
+	if err := validatePaneTitle("build #1"); err == nil {
+		t.Fatal("expected '#' to be rejected")
+	}
+	if err := validatePaneTitle("server logs"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSizeSpec(t *testing.T) {
+	s, err := parseSizeSpec("40%")
+	if err != nil || s.resolve(200, 100) != 80 {
+		t.Fatalf("40%% of 200: %+v %v", s, err)
+	}
+	s, _ = parseSizeSpec("30")
+	if s.resolve(200, 100) != 30 || s.resolve(20, 10) != 20 {
+		t.Fatalf("absolute size not clamped: %+v", s)
+	}
+	s, _ = parseSizeSpec("")
+	if s.resolve(200, 100) != 100 {
+		t.Fatal("empty spec should use the default")
+	}
+	for _, bad := range []string{"x", "0", "150%", "-3"} {
+		if _, err := parseSizeSpec(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+// captureStdout returns what fn prints to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = old
+	_ = w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestSplitPreviewLayout(t *testing.T) {
+	if lw, pw, ph := splitLayout(40, 120, UIOptions{}); lw != 60 || pw != 60 || ph != 40-listHeaderLines {
+		t.Fatalf("default split of 120x40: list=%d preview=%dx%d", lw, pw, ph)
+	}
+	w, _ := parseSizeSpec("30")
+	if lw, pw, _ := splitLayout(40, 120, UIOptions{PreviewWidth: w}); lw != 90 || pw != 30 {
+		t.Fatalf("-preview-width 30: list=%d preview=%d", lw, pw)
+	}
+	if lw, _, _ := splitLayout(0, 0, UIOptions{}); lw != 0 {
+		t.Fatal("unknown terminal size should fall back to the drawer preview")
+	}
+
+	long := Item{Kind: KindGitRepo, Name: "api", Path: "/code/" + strings.Repeat("x", 80)}
+	list := captureStdout(t, func() { renderList([]viewItem{{Item: long}}, 0, 20, UIOptions{}, false) })
+	if n := len([]rune(strings.TrimSuffix(list, "\n"))); n > 19 {
+		t.Fatalf("list row not clipped to the left pane: %d runes in %q", n, list)
+	}
+
+	side := captureStdout(t, func() { renderSidePreview(long, ActionSwitch, 4, 22, 10, 2) })
+	if !strings.HasPrefix(side, "\x1b[4;22H--- previe") || !strings.Contains(side, "\x1b[5;22HAction : ") {
+		t.Fatalf("preview lines not positioned in the right pane: %q", side)
+	}
+	if strings.Contains(side, "\x1b[6;22H") || !strings.HasSuffix(side, "\x1b[6;1H") {
+		t.Fatalf("preview not cut to its height: %q", side)
+	}
+}
+
+func TestRunTimeoutStartsAfterPicker(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "code", "api", ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(conf, []byte("scan_paths: ["+strconv.Quote(root)+"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "code_api"): errors.New("no")}}
+	shell = &slowShell{fakeShell: f, slow: k("tmux", "none")}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldIn := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = oldIn }()
+	go func() {
+		time.Sleep(60 * time.Millisecond) // a user slower than the timeout
+		_, _ = w.WriteString("\n1\n")
+		_ = w.Close()
+	}()
+	captureStdout(t, func() {
+		err = Run(Options{ConfigPath: conf, NoCache: true, NoAttach: true, Timeout: 20 * time.Millisecond})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := k("tmux", "new-session", "-ds", "code_api", "-c", filepath.Join(root, "code", "api")); !slices.Contains(f.calls, want) {
+		t.Fatalf("calls %q, want %q", f.calls, want)
+	}
+}
+
+func TestFullPage(t *testing.T) {
+	if got := fullPage(24); got != 20 {
+		t.Fatalf("fullPage(24)=%d want 20", got)
+	}
+	for _, rows := range []int{0, 4} {
+		if got := fullPage(rows); got != pageStep {
+			t.Fatalf("fullPage(%d)=%d want pageStep", rows, got)
+		}
+	}
+}
+
+func TestHistoryRecentSessions(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	for _, n := range []string{"a", "b", "a", "c"} {
+		if err := appendHistory(Item{Kind: KindSession, Name: n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := recentSessionNames()
+	if strings.Join(got, ",") != "c,a,b" {
+		t.Fatalf("recentSessionNames=%v", got)
+	}
+}
+
+func TestPickAction(t *testing.T) {
+	if a, err := parsePickAction(""); err != nil || a != ActionCreate {
+		t.Fatalf("default action: %q %v", a, err)
+	}
+	if _, err := parsePickAction("explode"); err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+	items := []Item{
+		{Kind: KindSession, Name: "s"},
+		{Kind: KindGitRepo, Name: "r", Path: "/r"},
+	}
+	if got := filterForAction(items, ActionKill); len(got) != 1 || got[0].Name != "s" {
+		t.Fatalf("kill should only offer sessions: %+v", got)
+	}
+	if got := filterForAction(items, ActionCreate); len(got) != 2 {
+		t.Fatalf("create should offer everything: %+v", got)
+	}
+
+	// the line-based fallback, used when stdin is not a terminal, must
+	// offer the same candidates as the raw-mode picker
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = old }()
+	_, _ = w.WriteString("\n1\n")
+	_ = w.Close()
+	var got Item
+	captureStdout(t, func() {
+		got, err = interactiveSelect([]Item{items[1], items[0]}, UIOptions{Action: ActionKill, MaxResults: 10})
+	})
+	if err != nil || got.Kind != KindSession {
+		t.Fatalf("kill fallback picked %+v, %v", got, err)
+	}
+}
+
+func TestStaleProjectFiles(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	tmp := t.TempDir()
+	mk := func(p string) { _ = os.MkdirAll(p, 0o755) }
+	touch := func(p string) { _ = os.WriteFile(p, []byte("{}\n"), 0o644) }
+	live, dead := filepath.Join(tmp, "live"), filepath.Join(tmp, "dead")
+	mk(filepath.Join(live, ".git"))
+	touch(filepath.Join(live, projectFileName))
+	mk(dead)
+	touch(filepath.Join(dead, projectFileName))
+
+	cfg := Config{ScanPaths: []string{tmp}, Exclude: defaultExclude(), MaxDepth: 3}
+	stale := staleProjectFiles(cfg)
+	if len(stale) != 1 || stale[0] != filepath.Join(dead, projectFileName) {
+		t.Fatalf("unexpected stale files: %v", stale)
+	}
+
+	if err := saveTrusted(Trusted{live: "x", dead: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(conf, []byte("scan_paths: ["+strconv.Quote(tmp)+"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() {
+		if err := runTidy(Options{ConfigPath: conf}, []string{"-dry-run"}); err != nil {
+			t.Error(err)
+		}
+	})
+	if _, err := os.Stat(filepath.Join(dead, projectFileName)); err != nil {
+		t.Fatalf("-dry-run removed a file: %v", err)
+	}
+	old := stdinLines
+	defer func() { stdinLines = old }()
+	stdinLines = bufio.NewReader(strings.NewReader("y\n"))
+	captureStdout(t, func() {
+		if err := runTidy(Options{ConfigPath: conf}, nil); err != nil {
+			t.Error(err)
+		}
+	})
+	if _, err := os.Stat(filepath.Join(dead, projectFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stale file not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(live, projectFileName)); err != nil {
+		t.Fatalf("live file removed: %v", err)
+	}
+	if got, _ := loadTrusted(); !maps.Equal(got, Trusted{live: "x"}) {
+		t.Fatalf("trusted after tidy: %v", got)
+	}
+}
+
+func TestBashCompletion(t *testing.T) {
+	var dyn, static strings.Builder
+	if err := writeBashCompletion(&dyn, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeBashCompletion(&static, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dyn.String(), "_tsm_sessions()") || !strings.Contains(dyn.String(), "rename-window") {
+		t.Fatalf("dynamic script lacks session completion:\n%s", dyn.String())
+	}
+	if strings.Contains(static.String(), "_tsm_sessions") {
+		t.Fatal("static script must not call tsm at runtime")
+	}
+}
+
+func TestScanStats(t *testing.T) {
+	items := []Item{{Kind: KindSession}, {Kind: KindGitRepo}, {Kind: KindWorktree}, {Kind: KindProject}, {Kind: KindBookmark}}
+	want := "# sessions=1 repos=2 projects=1 bookmarks=1 scan_time=284ms"
+	if got := scanStats(items, 284*time.Millisecond); got != want {
+		t.Fatalf("scanStats=%q want %q", got, want)
+	}
+}
+
+func TestMigrateConfigKeepsComments(t *testing.T) {
+	in := []byte("# my setup\nscan_paths:\n  - \"~/src\" # work\nmax_depth: 4\n")
+	out, steps, err := migrateConfig(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != configSchemaVersion {
+		t.Fatalf("expected %d steps, got %v", configSchemaVersion, steps)
+	}
+	s := string(out)
+	if !strings.Contains(s, "# my setup") || !strings.Contains(s, "# work") {
+		t.Fatalf("comments lost:\n%s", s)
+	}
+	if !strings.Contains(s, fmt.Sprintf("version: %d", configSchemaVersion)) {
+		t.Fatalf("version not written:\n%s", s)
+	}
+	again, steps, err := migrateConfig(out)
+	if err != nil || len(steps) != 0 || string(again) != s {
+		t.Fatalf("migration should be idempotent: %v %v", steps, err)
+	}
+}
+
+func TestSetupLogging(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	var buf strings.Builder
+	if err := setupLogging(&buf, "debug", "json"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("exec", "name", "tmux")
+	if !strings.Contains(buf.String(), `"msg":"exec"`) {
+		t.Fatalf("debug record missing: %q", buf.String())
+	}
+
+	buf.Reset()
+	t.Setenv("TSM_LOG_LEVEL", "error")
+	if err := setupLogging(&buf, "", "text"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Warn("quiet")
+	if buf.Len() != 0 {
+		t.Fatalf("warn logged at error level: %q", buf.String())
+	}
+	if err := setupLogging(&buf, "loud", ""); err == nil {
+		t.Fatal("expected error for invalid level")
+	}
+
+	release := holdLogs()
+	slog.Error("while picking")
+	if buf.Len() != 0 {
+		t.Fatalf("record written while held: %q", buf.String())
+	}
+	release()
+	if !strings.Contains(buf.String(), "while picking") {
+		t.Fatalf("held record not written on release: %q", buf.String())
+	}
+}
+
+func TestCapturePanes(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{out: map[string][]byte{
+		k("tmux", "list-panes", "-s", "-t", "proj", "-F", "#{window_index}.#{pane_index}"): []byte("0.0\n1.0\n"),
+		k("tmux", "capture-pane", "-p", "-t", "proj:0.0", "-S", "-2"):                      []byte("1\n2\n$ make\nok\n\n   \n\n"),
+		k("tmux", "capture-pane", "-p", "-t", "proj:1.0", "-S", "-2"):                      []byte("tail -f log\n"),
+	}}
+	// capture-pane -S -2 also returns the whole visible pane and the blank
+	// rows below the output; only the last 2 lines of output are kept.
+	got, err := capturePanes(context.Background(), "proj", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "==> proj:0.0 <==\n$ make\nok\n\n==> proj:1.0 <==\ntail -f log\n"
+	if got != want {
+		t.Fatalf("capturePanes=%q want %q", got, want)
+	}
+	if err := runPager(Options{}, []string{"-lines", "-1", "proj"}); err == nil {
+		t.Fatal("expected usage error for negative -lines")
+	}
+}
+
+func TestEnsurePaths(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	root := t.TempDir()
+	a := filepath.Join(root, "work", "a")
+	b := filepath.Join(root, "work", "b")
+	for _, d := range []string{a, b} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shell = &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "work_a"): errors.New("no"),
+		k("tmux", "has-session", "-t", "work_b"): nil,
+	}}
+
+	var out strings.Builder
+	missing := filepath.Join(root, "nope")
+	if n := ensurePaths(time.Second, Config{}, &out, []string{a, b, missing}); n != 1 {
+		t.Fatalf("failed=%d want 1", n)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != a+": created" || lines[1] != b+": exists" ||
+		!strings.HasPrefix(lines[2], missing+": error: ") {
+		t.Fatalf("unexpected status lines: %q", lines)
+	}
+
+	// A path that runs out of time must not use up the next path's time.
+	shell = &slowShell{
+		fakeShell: &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "work_a"): errors.New("no")}},
+		slow:      k("tmux", "new-session", "-ds", "work_a"),
+		delay:     50 * time.Millisecond,
+	}
+	out.Reset()
+	if n := ensurePaths(20*time.Millisecond, Config{}, &out, []string{a, b}); n != 1 {
+		t.Fatalf("failed=%d want 1\n%s", n, out.String())
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || lines[1] != b+": exists" {
+		t.Fatalf("unexpected status lines: %q", lines)
+	}
+}
+
+func TestCreateDetached(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	fs := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "code_a"): errors.New("no"),
+		// any switch or attach would fail the test
+		k("tmux", "switch-client", "-t", "code_a"): errors.New("switched"),
+		k("tmux", "attach", "-t", "code_a"):        errors.New("attached"),
+	}}
+	shell = fs
+	if err := createDetached(context.Background(), Config{}, Item{Kind: KindGitRepo, Name: "code_a", Path: "/code/a"}); err != nil {
+		t.Fatal(err)
+	}
+	fs.err[k("tmux", "new-session", "-ds", "code_a", "-c", "/code/a")] = errors.New("boom")
+	if err := createDetached(context.Background(), Config{}, Item{Kind: KindGitRepo, Name: "code_a", Path: "/code/a"}); err == nil {
+		t.Fatal("expected new-session error to propagate")
+	}
+}
+
+func TestRenderSessionName(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Code")
+	dir := filepath.Join(root, "myorg", "my repo")
+	data := nameTemplateData(dir, []string{root})
+	if data.Root != "Code" || data.Parent != "myorg" || data.Base != "my-repo" || data.Depth != 2 {
+		t.Fatalf("unexpected data: %+v", data)
+	}
+	cases := map[string]string{
+		"{{.Parent}}_{{.Base}}":           "myorg_my-repo",
+		"{{.Base}}":                       "my-repo",
+		"{{.Root}}/{{.Parent}}/{{.Base}}": "Code/myorg/my-repo",
+		"{{.Root}}:{{.Depth}}":            "Code-2",
+	}
+	for text, want := range cases {
+		tmpl, err := parseNameTemplate(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := renderSessionName(tmpl, data); err != nil || got != want {
+			t.Fatalf("%s: got %q, %v want %q", text, got, err, want)
+		}
+	}
+	tmpl, _ := parseNameTemplate("{{.Root}}")
+	if _, err := renderSessionName(tmpl, NameTemplateData{}); err == nil {
+		t.Fatal("expected error for empty name")
+	}
+}
+
+func TestRecentItems(t *testing.T) {
+	dir := t.TempDir()
+	gone := filepath.Join(dir, "gone")
+	hist := []HistoryEntry{
+		{Kind: KindGitRepo, Name: "old", Path: dir},
+		{Kind: KindGitRepo, Name: "moved", Path: gone},
+		{Kind: KindSession, Name: "work"},
+		{Kind: KindGitRepo, Name: "repo", Path: dir},
+		{Kind: KindSession, Name: "work"},
+	}
+	got := recentItems(hist, []string{"work"}, 10)
+	want := []Item{
+		{Kind: KindSession, Name: "work"},
+		{Kind: KindGitRepo, Name: "repo", Path: dir},
+		{Kind: KindGitRepo, Name: "old", Path: dir},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("recentItems=%v want %v", got, want)
+	}
+	if got := recentItems(hist, []string{"work"}, 2); len(got) != 2 {
+		t.Fatalf("limit not applied: %v", got)
+	}
+}
+
+func TestRepairLinksAutoRemove(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	alive := t.TempDir()
+	if err := saveLinks(Links{"ok": alive, "b": "/nonexistent/b", "a": "/nonexistent/a"}); err != nil {
+		t.Fatal(err)
+	}
+	links, _ := loadLinks()
+	if got := brokenLinks(links); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("brokenLinks=%v", got)
+	}
+	if err := runRepairLinks(Options{}, []string{"-auto-remove"}); err != nil {
+		t.Fatal(err)
+	}
+	links, _ = loadLinks()
+	if !reflect.DeepEqual(links, Links{"ok": alive}) {
+		t.Fatalf("links after repair: %v", links)
+	}
+}
+
+func TestRepairLinkInteractive(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	old := stdinLines
+	defer func() { stdinLines = old }()
+	// answers for both prompts come from one buffered stream
+	stdinLines = bufio.NewReader(strings.NewReader("n\n\nn\n" + dir + "\n"))
+	links := Links{"a": "/nonexistent/a", "b": "/nonexistent/b"}
+	var changed [2]bool
+	captureStdout(t, func() {
+		changed[0] = repairLinkInteractive(links, "a")
+		changed[1] = repairLinkInteractive(links, "b")
+	})
+	if changed[0] || links["a"] != "/nonexistent/a" {
+		t.Fatalf("an empty new path should keep the link: %v %v", changed[0], links)
+	}
+	if !changed[1] || links["b"] != dir {
+		t.Fatalf("new path not applied: %v %v", changed[1], links)
+	}
+}
+
+func TestDetectTermCapabilities(t *testing.T) {
+	cases := []struct {
+		term, program string
+		want          TermCapabilities
+	}{
+		{"dumb", "", TermCapabilities{}},
+		{"", "", TermCapabilities{}},
+		{"xterm-256color", "", TermCapabilities{CursorMovement: true, Unicode: true, Colors: 256}},
+		{"screen", "", TermCapabilities{CursorMovement: true, Unicode: true, Colors: 8}},
+		{"xterm-256color", "Apple_Terminal", TermCapabilities{CursorMovement: true, Unicode: true, Colors: 8}},
+	}
+	for _, c := range cases {
+		if got := detectTermCapabilities(c.term, c.program); got != c.want {
+			t.Fatalf("detect(%q, %q)=%+v want %+v", c.term, c.program, got, c.want)
+		}
+	}
+}
+
+func TestSessionNameFromEnv(t *testing.T) {
+	t.Setenv("PROJECT_NAME", "My Project!")
+	if got := sessionNameFromEnv("PROJECT_NAME"); got != "My-Project" {
+		t.Fatalf("got %q", got)
+	}
+	t.Setenv("PROJECT_NAME", "")
+	if got := sessionNameFromEnv("PROJECT_NAME"); got != "" {
+		t.Fatalf("empty variable should fall back, got %q", got)
+	}
+	if got := sessionNameFromEnv(""); got != "" {
+		t.Fatalf("no variable should fall back, got %q", got)
+	}
+}
+
+func TestConfigLint(t *testing.T) {
+	schema := configJSONSchema()
+	props := schema["properties"].(map[string]any)
+	for key := range configDocs {
+		if _, ok := props[key]; !ok {
+			t.Fatalf("schema is missing %q", key)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "max_depth: three\nmax_config_backups: -1\nscan_paths: [~/Code, 3]\nsplit_preview: true\ncolour: red\n" +
+		"theme: {session_color: 36, repo_color: \"1;32\", bookmark_color: [red]}\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	if err := readConfigFile(v, path); err != nil {
+		t.Fatal(err)
+	}
+	errs, warnings := lintConfig(v.AllSettings(), schema)
+	want := []string{
+		"max_config_backups: must be >= 0, got -1",
+		`max_depth: expected integer, got string "three"`,
+		"scan_paths: item 1: expected string, got number 3",
+		"theme: bookmark_color: expected string or integer, got array",
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("errs=%q want %q", errs, want)
+	}
+	if !reflect.DeepEqual(warnings, []string{`unknown key "colour"`}) {
+		t.Fatalf("warnings=%q", warnings)
+	}
+	if err := runConfigLint(Options{ConfigPath: path}, nil); err == nil {
+		t.Fatal("expected lint to fail")
+	}
+}
+
+func TestFormatRow(t *testing.T) {
+	it := Item{Kind: KindGitRepo, Name: "org_repo", Path: "/code/org/repo"}
+	if got := formatRow(it, parseSeparator(`\t`)); got != "G\torg_repo\t/code/org/repo" {
+		t.Fatalf("tab separator: %q", got)
+	}
+	if got := formatRow(it, " | "); got != "G | org_repo | /code/org/repo" {
+		t.Fatalf("pipe separator: %q", got)
+	}
+	if got := formatRow(it, ""); !strings.HasPrefix(got, "G   org_repo ") {
+		t.Fatalf("default padding: %q", got)
+	}
+	if got := parseSeparator(`"`); got != `"` {
+		t.Fatalf("unquotable separator should pass through: %q", got)
+	}
+}
+
+func TestFuzzyRows(t *testing.T) {
+	items := []Item{
+		{Kind: KindSession, Name: "util"},
+		{Kind: KindGitRepo, Name: "api", Path: "/code/api"},
+		{Kind: KindGitRepo, Name: "web_app", Path: "/code/web_app"},
+	}
+	rows := fuzzyRows(items, "ap", MatchOptions{})
+	if rows[0].Name != "api" || rows[0].detail != (fuzzyDetail{Base: 4, Streak: 1, Prefix: 5}) {
+		t.Fatalf("top row: %+v", rows[0])
+	}
+	if rows[2].Name != "util" || rows[2].matched {
+		t.Fatalf("non-matching items should sort last: %+v", rows[2])
+	}
+	for _, r := range rows[:2] {
+		if r.detail.total() != fuzzyScore("ap", matchKey(r.Item), MatchOptions{}) {
+			t.Fatalf("detail does not add up for %s", r.Name)
+		}
+	}
+}
+
+func TestScanFindsWorktrees(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{avail: map[string]bool{}}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	tmp := t.TempDir()
+	repo := filepath.Join(tmp, "repo")
+	wt := filepath.Join(tmp, "repo-feature")
+	sub := filepath.Join(tmp, "other", "vendor-sub")
+	for _, d := range []string{filepath.Join(repo, ".git", "worktrees", "feature"), wt, sub} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(dir, gitdir string) {
+		if err := os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+gitdir+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(wt, filepath.Join(repo, ".git", "worktrees", "feature"))
+	write(sub, filepath.Join(tmp, "other", ".git", "modules", "vendor-sub")) // submodule, not a worktree
+
+	items := buildItems(context.Background(), Config{ScanPaths: []string{tmp}, MaxDepth: 3})
+	kinds := map[string]ItemKind{}
+	for _, it := range items {
+		kinds[it.Path] = it.Kind
+	}
+	if kinds[repo] != KindGitRepo || kinds[wt] != KindWorktree {
+		t.Fatalf("unexpected kinds: %v", kinds)
+	}
+	if _, ok := kinds[sub]; ok {
+		t.Fatalf("submodule .git file should not be listed: %v", kinds)
+	}
+}
+
+func TestScanProjectMarkers(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{avail: map[string]bool{}}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	tmp := t.TempDir()
+	repo := filepath.Join(tmp, "repo")
+	proj := filepath.Join(tmp, "proj")
+	_ = os.MkdirAll(filepath.Join(repo, ".git"), 0o755)
+	_ = os.MkdirAll(proj, 0o755)
+	_ = os.WriteFile(filepath.Join(repo, "go.mod"), nil, 0o644)
+	_ = os.WriteFile(filepath.Join(proj, "Cargo.toml"), nil, 0o644)
+
+	cfg := Config{ScanPaths: []string{tmp}, MaxDepth: 3}
+	if repos := scanGitReposConcurrent(cfg); !slices.Equal(repos, []string{repo}) {
+		t.Fatalf("default markers should only find git repos: %v", repos)
+	}
+	cfg.ProjectMarkers = []string{".git", "go.mod", "Cargo.toml"}
+	kinds := map[string]ItemKind{}
+	for _, it := range buildItems(context.Background(), cfg) {
+		kinds[it.Path] = it.Kind
+	}
+	if len(kinds) != 2 || kinds[repo] != KindGitRepo || kinds[proj] != KindProject {
+		t.Fatalf("unexpected kinds: %v", kinds)
+	}
+}
+
+func TestFilterByPath(t *testing.T) {
+	items := []Item{
+		{Kind: KindSession, Name: "scratch"},
+		{Kind: KindGitRepo, Name: "ivuorinen_a", Path: "/home/u/Code/ivuorinen/a"},
+		{Kind: KindGitRepo, Name: "other_b", Path: "/home/u/Code/other/b"},
+		{Kind: KindBookmark, Name: "u_notes", Path: "/home/u/notes"},
+	}
+	got, err := filterByPath(items, []string{"*/ivuorinen/*", "*/note?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "ivuorinen_a" || got[1].Name != "u_notes" {
+		t.Fatalf("filterByPath=%v", got)
+	}
+	if got, _ := filterByPath(items, []string{"*/[!i]*/b"}); len(got) != 1 || got[0].Name != "other_b" {
+		t.Fatalf("negated class: %v", got)
+	}
+	if _, err := filterByPath(items, []string{"*/[abc"}); err == nil {
+		t.Fatal("expected error for unterminated class")
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dotfiles := t.TempDir()
+	if _, err := bootstrapSource(dotfiles); !errors.Is(err, ErrConfigNotFound) {
+		t.Fatalf("expected ErrConfigNotFound, got %v", err)
+	}
+	src := filepath.Join(dotfiles, ".config", "tsm")
+	if err := os.MkdirAll(filepath.Join(src, "layouts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "config.yaml"), []byte("max_depth: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "layouts", "dev.yaml"), []byte("windows: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runBootstrap(Options{}, []string{dotfiles}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig("")
+	if err != nil || cfg.MaxDepth != 2 {
+		t.Fatalf("installed config not loaded: %+v %v", cfg, err)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "tsm", "layouts", "dev.yaml")); err != nil {
+		t.Fatalf("nested file not copied: %v", err)
+	}
+}
+
+func TestBootstrapReplacesOtherFormat(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	dst := filepath.Join(xdg, "tsm")
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "config.toml"), []byte("max_depth = 7\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dotfiles := t.TempDir()
+	src := filepath.Join(dotfiles, "tsm")
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "config.yaml"), []byte("max_depth: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := stdinLines
+	defer func() { stdinLines = old }()
+	stdinLines = bufio.NewReader(strings.NewReader("y\n"))
+
+	var err error
+	captureStdout(t, func() { err = runBootstrap(Options{}, []string{dotfiles}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := configFiles(dst); !slices.Equal(got, []string{filepath.Join(dst, "config.yaml")}) {
+		t.Fatalf("config files after bootstrap: %q", got)
+	}
+	if backups, _ := listBackups(); len(backups) != 1 || !strings.Contains(filepath.Base(backups[0]), "config.toml.bak.") {
+		t.Fatalf("old toml config not backed up: %q", backups)
+	}
+	if cfg, err := loadConfig(""); err != nil || cfg.MaxDepth != 2 {
+		t.Fatalf("installed config not loaded: %+v %v", cfg, err)
+	}
+}
+
+func TestSwitchToSessionFlags(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	// only the exact commands with the configured flags succeed
+	fs := &fakeShell{err: map[string]error{
+		k("tmux", "switch-client", "-t", "work"): errors.New("flags missing"),
+		k("tmux", "attach", "-t", "work"):        errors.New("flags missing"),
+	}}
+	shell = fs
+	cfg := Config{TmuxSwitchFlags: []string{"-E"}, TmuxAttachFlags: []string{"-d", "-x"}}
+	if err := switchToSession(context.Background(), cfg, "work", true); err != nil {
+		t.Fatalf("switch-client: %v", err)
+	}
+	if err := switchToSession(context.Background(), cfg, "work", false); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if err := switchToSession(context.Background(), Config{}, "work", true); err == nil {
+		t.Fatal("expected plain switch-client to hit the fake error")
+	}
+}
+
+func TestImportProjectile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := t.TempDir()
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "we\"ird")
+	for _, d := range []string{a, b} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eld := fmt.Sprintf("(%q %q \"%s/gone/\")\n", a+"/", b+"/", root)
+	if got := parseProjectileBookmarks(eld); len(got) != 3 || got[1] != b+"/" {
+		t.Fatalf("parse: %q", got)
+	}
+	eldPath := filepath.Join(root, "projectile-bookmarks.eld")
+	if err := os.WriteFile(eldPath, []byte(eld), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgPath := filepath.Join(root, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte("# mine\nbookmarks:\n  - "+a+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runImportProjectile(Options{ConfigPath: cfgPath}, []string{"-file", eldPath}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Bookmarks, []string{a, b}) {
+		t.Fatalf("bookmarks=%q", cfg.Bookmarks)
+	}
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# mine\n") {
+		t.Fatalf("comment lost:\n%s", data)
+	}
+}
+
+func TestEnvDiff(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{out: map[string][]byte{
+		k("tmux", "show-environment", "-t", "a"): []byte("HOME=/home/u\nAWS_PROFILE=dev\nOLD=1\n-DISPLAY\n"),
+		k("tmux", "show-environment", "-t", "b"): []byte("HOME=/home/u\nAWS_PROFILE=prod\nNEW=2\n"),
+	}}
+	ctx := context.Background()
+	a, _ := sessionEnv(ctx, "a")
+	b, _ := sessionEnv(ctx, "b")
+	if _, ok := a["-DISPLAY"]; ok {
+		t.Fatal("removed variable should be skipped")
+	}
+	want := []string{"~ AWS_PROFILE: dev → prod", "+ NEW=2", "- OLD=1"}
+	if got := envDiffLines(a, b, false); !reflect.DeepEqual(got, want) {
+		t.Fatalf("envDiffLines=%q want %q", got, want)
+	}
+	if got := envDiffLines(a, b, true); got[1] != "\x1b[32m+ NEW=2\x1b[0m" {
+		t.Fatalf("colour: %q", got[1])
+	}
+}
+
+func TestSessionCount(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	list := k("tmux", "list-sessions", "-F", "#S")
+	ctx := context.Background()
+
+	shell = &fakeShell{out: map[string][]byte{list: []byte("a\nb\n")}}
+	if n, st := sessionCount(ctx); n != 2 || st != 0 {
+		t.Fatalf("running: %d %d", n, st)
+	}
+	shell = &fakeShell{out: map[string][]byte{list: []byte("\n")}}
+	if n, st := sessionCount(ctx); n != 0 || st != 1 {
+		t.Fatalf("no sessions: %d %d", n, st)
+	}
+	shell = &fakeShell{err: map[string]error{list: errors.New("no server running")}}
+	if _, st := sessionCount(ctx); st != 2 {
+		t.Fatalf("no server: %d", st)
+	}
+	shell = &fakeShell{avail: map[string]bool{}}
+	if _, st := sessionCount(ctx); st != 2 {
+		t.Fatalf("no tmux: %d", st)
+	}
+}
+
+func TestWindowLayout(t *testing.T) {
+	if err := validateWindowLayout("tiled"); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateWindowLayout("spiral"); err == nil {
+		t.Fatal("expected error for unknown layout")
+	}
+	old := shell
+	defer func() { shell = old }()
+	fs := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "p"): errors.New("no"),
+	}}
+	shell = fs
+	cfg := Config{WindowLayout: "main-vertical"}
+	fs.err[k("tmux", "select-layout", "-t", "p", "main-vertical")] = errors.New("layout applied")
+	if _, err := createOrSwitchForDir(context.Background(), cfg, "p", "/p", true); err == nil || !strings.Contains(err.Error(), "layout applied") {
+		t.Fatalf("expected select-layout to run for a new session, got %v", err)
+	}
+	delete(fs.err, k("tmux", "has-session", "-t", "p"))
+	if _, err := createOrSwitchForDir(context.Background(), cfg, "p", "/p", true); err != nil {
+		t.Fatalf("existing session must not be re-laid out: %v", err)
+	}
+}
+
+func TestSelectionTextAndZshWidget(t *testing.T) {
+	if got := selectionText(Item{Kind: KindGitRepo, Name: "org_a", Path: "/code/org/a"}); got != "/code/org/a" {
+		t.Fatalf("repo selection: %q", got)
+	}
+	if got := selectionText(Item{Kind: KindSession, Name: "scratch"}); got != "scratch" {
+		t.Fatalf("session selection: %q", got)
+	}
+	if !strings.Contains(zshWidget, "tsm -select") || !strings.Contains(zshWidget, "bindkey '^T' tsm-widget") {
+		t.Fatalf("widget does not call the picker:\n%s", zshWidget)
+	}
+}
+
+func TestKillSessionInvokesTmux(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	fs := &fakeShell{}
+	shell = fs
+	if err := killSession(context.Background(), "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{k("tmux", "kill-session", "-t", "stale")}; !reflect.DeepEqual(fs.calls, want) {
+		t.Fatalf("calls=%q want %q", fs.calls, want)
+	}
+	fs.err = map[string]error{k("tmux", "kill-session", "-t", "gone"): errors.New("can't find session")}
+	if err := killSession(context.Background(), "gone"); err == nil || !strings.Contains(err.Error(), "kill gone") {
+		t.Fatalf("expected wrapped kill error, got %v", err)
+	}
+}
+
+func TestKillFromPicker(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	fs := &fakeShell{err: map[string]error{k("tmux", "kill-session", "-t", "gone"): errors.New("can't find session")}}
+	shell = fs
+	ui := UIOptions{OnKill: func(it Item) error { return killSession(context.Background(), it.Name) }}
+	all := []Item{{Kind: KindSession, Name: "api"}, {Kind: KindSession, Name: "gone"}, {Kind: KindGitRepo, Name: "api", Path: "/code/api"}}
+
+	left, status := killFromPicker(ui, all, all[0])
+	if status != "killed api" || len(left) != 2 || left[0].Name != "gone" || left[1].Kind != KindGitRepo {
+		t.Fatalf("after killing api: %q %v", status, left)
+	}
+	if want := []string{k("tmux", "kill-session", "-t", "api")}; !slices.Equal(fs.calls, want) {
+		t.Fatalf("calls=%q want %q", fs.calls, want)
+	}
+	if len(all) != 3 {
+		t.Fatal("the caller's items were modified")
+	}
+
+	if left, status = killFromPicker(ui, all, all[1]); len(left) != 3 || !strings.Contains(status, "kill gone") {
+		t.Fatalf("failed kill: %q %v", status, left)
+	}
+	fs.calls = nil
+	if left, status = killFromPicker(ui, all, all[2]); len(left) != 3 || !strings.Contains(status, "not a running session") || len(fs.calls) != 0 {
+		t.Fatalf("killing a repo: %q %v %v", status, left, fs.calls)
+	}
+}
+
+func TestStartupLayout(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	dir := t.TempDir()
+	api, web := filepath.Join(dir, "api"), filepath.Join(dir, "web")
+	file := filepath.Join(dir, "sessions.yaml")
+	layout := fmt.Sprintf("sessions:\n  - name: backend\n    path: %s\n    command: make dev\n  - path: %s\n", api, web)
+	if err := os.WriteFile(file, []byte(layout), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := loadStartupLayout(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webName := sessionNameFromPath(web)
+	if l.Sessions[0].Name != "backend" || l.Sessions[1].Name != webName {
+		t.Fatalf("names: %+v", l.Sessions)
+	}
+
+	fs := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "backend"): errors.New("no"),
+	}}
+	shell = fs
+	cfg := Config{
+		Layouts:           map[string]string{"*/api": "dev"},
+		LayoutDefinitions: map[string][]LayoutWindow{"dev": {{Name: "logs"}}},
+	}
+	if err := runStartupLayout(context.Background(), cfg, file); err != nil {
+		t.Fatal(err)
+	}
+	// the command goes to the first window, not the layout window opened last
+	want := []string{
+		k("tmux", "new-session", "-ds", "backend", "-c", api),
+		k("tmux", "new-window", "-t", "backend", "-c", api, "-n", "logs"),
+		k("tmux", "send-keys", "-t", "backend:^", "make dev", "Enter"),
+	}
+	var backend []string
+	for _, c := range fs.calls {
+		for _, p := range []string{"tmux new-session -ds backend ", "tmux new-window -t backend ", "tmux send-keys -t backend"} {
+			if strings.HasPrefix(c, p) {
+				backend = append(backend, c)
+			}
+		}
+	}
+	if !slices.Equal(backend, want) {
+		t.Fatalf("backend calls %q, want %q", backend, want)
+	}
+	if slices.Contains(fs.calls, k("tmux", "new-session", "-ds", webName, "-c", web)) {
+		t.Fatal("existing session was recreated")
+	}
+	if last := fs.calls[len(fs.calls)-1]; !strings.HasSuffix(last, "-t backend") {
+		t.Fatalf("expected to switch to the first session last, got %q", last)
+	}
+}
+
+func TestCleanRepos(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{
+		out: map[string][]byte{
+			k("git", "-C", "/dirty", "status", "--porcelain"): []byte(" M main.go\n"),
+		},
+		err: map[string]error{
+			k("git", "-C", "/broken", "status", "--porcelain"): errors.New("not a git repository"),
+		},
+	}
+	items := []Item{
+		{Kind: KindSession, Name: "s"},
+		{Kind: KindGitRepo, Name: "clean", Path: "/clean"},
+		{Kind: KindGitRepo, Name: "dirty", Path: "/dirty"},
+		{Kind: KindWorktree, Name: "wt", Path: "/wt"},
+		{Kind: KindGitRepo, Name: "broken", Path: "/broken"},
+		{Kind: KindBookmark, Name: "b", Path: "/b"},
+	}
+	got := cleanRepos(context.Background(), items)
+	if len(got) != 2 || got[0].Name != "clean" || got[1].Name != "wt" {
+		t.Fatalf("cleanRepos=%v", got)
+	}
+	if err := requireGit(Config{DisableGitChecks: true}, "-require-clean"); err == nil {
+		t.Fatal("expected -no-git to block git features")
+	}
+}
+
+func TestNoGitRunsNoGit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "org", "repo", ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte("scan_paths: ["+strconv.Quote(root)+"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{}
+	shell = f
+
+	opts := Options{ConfigPath: cfgPath, NoGit: true}
+	if err := runOpenURL(opts, []string{"org_repo"}); err == nil || !strings.Contains(err.Error(), "git checks are disabled") {
+		t.Fatalf("open-url with -no-git: %v", err)
+	}
+	opts.RequireClean, opts.Print = true, true
+	if err := Run(opts); err == nil || !strings.Contains(err.Error(), "git checks are disabled") {
+		t.Fatalf("-require-clean with -no-git: %v", err)
+	}
+	for _, c := range f.calls {
+		if strings.HasPrefix(c, "git ") {
+			t.Fatalf("-no-git ran %q", c)
+		}
+	}
+}
+
+func TestConfigFormats(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	var out strings.Builder
+	if err := writeDefaultConfig(&out, "toml"); err != nil {
+		t.Fatal(err)
+	}
+	tomlPath := filepath.Join(xdg, "tsm", "config.toml")
+	if got, _ := xdgConfigPath(); got != tomlPath {
+		t.Fatalf("xdgConfigPath=%q want %q", got, tomlPath)
+	}
+	cfg, err := loadConfig("")
+	if err != nil || cfg.Version != configSchemaVersion || len(cfg.Bookmarks) != 1 {
+		t.Fatalf("toml config not loaded: %+v %v", cfg, err)
+	}
+	if err := writeDefaultConfig(&out, "yaml"); err == nil {
+		t.Fatal("expected an existing toml config to block -init-config")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir()) // no config, so only the format can fail
+	if err := writeDefaultConfig(&out, "ini"); err == nil || !strings.Contains(err.Error(), "unsupported config format") {
+		t.Fatalf("expected error for unsupported format, got %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"config.json", "config.toml", "config.yaml"} {
+		_ = os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+	}
+	if got := findConfigFile(dir); filepath.Base(got) != "config.yaml" {
+		t.Fatalf("yaml should win, got %s", got)
+	}
+	_ = os.Remove(filepath.Join(dir, "config.yaml"))
+	if got := findConfigFile(dir); filepath.Base(got) != "config.toml" {
+		t.Fatalf("toml should beat json, got %s", got)
+	}
+}
+
+func TestInitConfigWithExamplesKeepsExisting(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	cfgPath := filepath.Join(xdg, "tsm", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, []byte("max_depth: 5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := initConfig(&out, "", false); !errors.Is(err, ErrConfigExists) {
+		t.Fatalf("expected ErrConfigExists without -with-examples, got %v", err)
+	}
+	out.Reset()
+	if err := initConfig(&out, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Skipped default config") || !strings.Contains(out.String(), "Wrote example config") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	if data, _ := os.ReadFile(cfgPath); string(data) != "max_depth: 5\n" {
+		t.Fatalf("existing config changed: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(xdg, "tsm", "config.example.yaml")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNameTemplateConfig(t *testing.T) {
+	defer activeNameTemplate.Store(nil)
+	root := filepath.Join(t.TempDir(), "Code")
+	dir := filepath.Join(root, "org", "repo")
+
+	if err := useNameTemplate(Config{NameTemplate: "{{.Base}}", ScanPaths: []string{root}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionNameFromPath(dir); got != "repo" {
+		t.Fatalf("base template: %q", got)
+	}
+	if err := useNameTemplate(Config{NameTemplate: "{{.Root}}", ScanPaths: []string{root}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionNameFromPath("/elsewhere/x"); got != "elsewhere_x" {
+		t.Fatalf("empty render should fall back to the default, got %q", got)
+	}
+	if err := useNameTemplate(Config{NameTemplate: "{{.Nope"}); err == nil {
+		t.Fatal("expected parse error")
+	}
+	if err := useNameTemplate(Config{}); err != nil || sessionNameFromPath(dir) != "org_repo" {
+		t.Fatalf("empty template should restore the default: %v %q", err, sessionNameFromPath(dir))
+	}
+}
+
+func TestCopySelection(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{avail: map[string]bool{}} // no clipboard tool
+	ctx := context.Background()
+	if err := copySelection(ctx, Item{Kind: KindSession, Name: "s"}, false); err == nil || !strings.Contains(err.Error(), "no path") {
+		t.Fatalf("expected missing-path error, got %v", err)
+	}
+	if err := copySelection(ctx, Item{Kind: KindSession, Name: "s"}, true); err == nil || strings.Contains(err.Error(), "no path") {
+		t.Fatalf("session name copy should only fail on the clipboard tool, got %v", err)
+	}
+	if err := runCopyPath(Options{}, []string{"a", "b"}); err == nil {
+		t.Fatal("expected usage error")
+	}
+}
+
+func TestApplyThreshold(t *testing.T) {
+	cands := []viewItem{{score: 20}, {score: 15}, {score: 9}, {score: 2}}
+	if got := applyThreshold(cands, 0); len(got) != 4 {
+		t.Fatalf("threshold 0 should keep all, got %d", len(got))
+	}
+	if got := applyThreshold(cands, 50); len(got) != 2 {
+		t.Fatalf("threshold 50: got %d candidates", len(got))
+	}
+	if got := applyThreshold(cands, 100); len(got) != 1 {
+		t.Fatalf("threshold 100 should keep only the best, got %d", len(got))
+	}
+}
+
+func TestScanReposCached(t *testing.T) {
+	tmp := t.TempDir()
+	cache := filepath.Join(t.TempDir(), "repos.json")
+	_ = os.MkdirAll(filepath.Join(tmp, "org", "a", ".git"), 0o755)
+	_ = os.MkdirAll(filepath.Join(tmp, "org", "b"), 0o755)
+	cfg := Config{ScanPaths: []string{tmp}, MaxDepth: 3, CacheTTL: time.Minute}
+	now := time.Now()
+	if got := scanReposCached(cfg, cache, false, now); len(got) != 1 {
+		t.Fatalf("first scan: %v", got)
+	}
+
+	// A repo appearing below an existing directory leaves org's mtime alone,
+	// so the cached subtree is reused until it expires or is refreshed.
+	_ = os.MkdirAll(filepath.Join(tmp, "org", "b", ".git"), 0o755)
+	if got := scanReposCached(cfg, cache, false, now.Add(time.Second)); len(got) != 1 {
+		t.Fatalf("cached scan should not re-walk org: %v", got)
+	}
+	if got := scanReposCached(cfg, cache, false, now.Add(2*time.Minute)); len(got) != 2 {
+		t.Fatalf("expired entry should be re-walked: %v", got)
+	}
+	_ = os.RemoveAll(filepath.Join(tmp, "org", "b", ".git"))
+	if got := scanReposCached(cfg, cache, true, now.Add(2*time.Minute)); len(got) != 1 {
+		t.Fatalf("refresh should re-walk: %v", got)
+	}
+}
+
+func TestScanWithLimitedConcurrency(t *testing.T) {
+	var roots []string
+	for range 6 {
+		root := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(root, "r", ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	for _, limit := range []int{1, 2} {
+		s := newRepoScanner(Config{ScanPaths: roots, MaxDepth: 3, MaxScanConcurrency: limit})
+		// every walk enters one top-level directory; hold each one open
+		// briefly and record how many overlap
+		var active, peak atomic.Int32
+		s.descend = func(string) bool {
+			n := active.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(20 * time.Millisecond)
+			active.Add(-1)
+			return true
+		}
+		if repos := s.scan(); len(repos) != 6 {
+			t.Fatalf("limit %d: expected a repo per scan path, got %v", limit, repos)
+		}
+		if got := peak.Load(); got != int32(limit) {
+			t.Fatalf("limit %d: %d walks ran at once", limit, got)
+		}
+	}
+}
+
+func TestResetConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func() {
+		if err := os.WriteFile(path, []byte("max_depth: 2\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	no := func(string) bool { return false }
+	yes := func(string) bool { return true }
+
+	write()
+	if err := resetConfig(path, false, 10, no); !errors.Is(err, ErrCancelled) {
+		t.Fatalf("declined reset: err=%v", err)
+	}
+	// a second backup must not replace the first
+	for range 2 {
+		if err := resetConfig(path, true, 10, yes); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("config should be gone: %v", err)
+		}
+		write()
+	}
+	if backups, _ := listBackups(); len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %q", backups)
+	}
+	if err := resetConfig(path, false, 10, yes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("config should be gone: %v", err)
+	}
+}
+
+func TestRenameSession(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	fake := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "gone"):    errors.New("no"),
+		k("tmux", "has-session", "-t", "new-one"): errors.New("no"),
+	}}
+	shell = fake
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(cfgPath, []byte("# mine\nbookmarks:\n  - old\n  - /keep\n"), 0o644)
+	_ = saveLinks(Links{"old": "/code/old"})
+
+	if err := runRename(Options{ConfigPath: cfgPath}, []string{"gone", "x"}); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("expected ErrNoSession, got %v", err)
+	}
+	if err := runRename(Options{ConfigPath: cfgPath}, []string{"old", "new one"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(fake.calls, k("tmux", "rename-session", "-t", "old", "new-one")) {
+		t.Fatalf("rename-session not run with the sanitized name: %v", fake.calls)
+	}
+	links, _ := loadLinks()
+	if links["new-one"] != "/code/old" || links["old"] != "" {
+		t.Fatalf("link not moved: %v", links)
+	}
+	data, _ := os.ReadFile(cfgPath)
+	if !strings.Contains(string(data), "- new-one") || !strings.Contains(string(data), "# mine") {
+		t.Fatalf("bookmark not rewritten:\n%s", data)
+	}
+}
+
+func TestListHooksTest(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	t.Chdir(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("hooks:\n  pre_create: [\"make deps\"]\n  post_create: [\"false\", \"true\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"TSM_SESSION=" + hookTestSession, "TSM_DIR=" + cwd, "TSM_HOOK_TEST=1"}
+	argv := func(c string) string {
+		name, args := hookArgv(c, env...)
+		return k(name, args...)
+	}
+	old := shell
+	defer func() { shell = old }()
+	fake := &fakeShell{err: map[string]error{argv("false"): errors.New("exit status 1")}}
+	shell = fake
+
+	out := captureStdout(t, func() { err = runListHooks(Options{ConfigPath: path}, []string{"-test"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{argv("make deps"), argv("false"), argv("true")}; !slices.Equal(fake.calls, want) {
+		t.Fatalf("calls=%q want %q", fake.calls, want)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[1], "make deps  ok") ||
+		!strings.HasSuffix(lines[2], "FAIL: exit status 1") || !strings.HasSuffix(lines[3], "true       ok") {
+		t.Fatalf("table:\n%s", out)
+	}
+
+	var printed bytes.Buffer
+	fake.calls = nil
+	shell = dryRunShell{inner: fake, w: &printed}
+	out = captureStdout(t, func() { err = runListHooks(Options{ConfigPath: path}, []string{"-test"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.calls) != 0 || printed.Len() != 0 {
+		t.Fatalf("dry run ran hooks: calls=%q printed=%q", fake.calls, printed.String())
+	}
+	if n := strings.Count(out, "skipped (dry run)"); n != 3 {
+		t.Fatalf("dry run table:\n%s", out)
+	}
+}
+
+func TestLayoutWindows(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	fake := &fakeShell{}
+	shell = fake
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(path, []byte(`layouts:
+  "*/api-*": Editor+Server
+layout_definitions:
+  editor+server:
+    - name: editor
+      cmd: nvim
+    - name: server
+      dir: cmd/server
+      cmd: go run .
+`), 0o644)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lintConfigFile(path); err != nil {
+		t.Fatalf("layouts should lint clean: %v", err)
+	}
+	if wins, _ := layoutFor(cfg, "/code/web"); wins != nil {
+		t.Fatalf("unexpected layout for /code/web: %v", wins)
+	}
+	if err := setupNewSession(context.Background(), cfg, "code_api-users", "/code/api-users"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		k("tmux", "new-window", "-t", "code_api-users", "-c", "/code/api-users", "-n", "editor"),
+		k("tmux", "send-keys", "-t", "code_api-users", "nvim", "Enter"),
+		k("tmux", "new-window", "-t", "code_api-users", "-c", filepath.Join("/code/api-users", "cmd/server"), "-n", "server"),
+		k("tmux", "send-keys", "-t", "code_api-users", "go run .", "Enter"),
+	}
+	if !slices.Equal(fake.calls, want) {
+		t.Fatalf("calls=%q\nwant %q", fake.calls, want)
+	}
+
+	cfg.Layouts["*/web*"] = "missing"
+	if _, err := layoutFor(cfg, "/code/web"); err == nil {
+		t.Fatal("expected an error for an undefined layout")
+	}
+}
+
+func TestThemes(t *testing.T) {
+	dark, err := lookupTheme("")
+	if err != nil || dark != themes["dark"] {
+		t.Fatalf("default scheme should be dark: %+v %v", dark, err)
+	}
+	if _, err := lookupTheme("neon"); err == nil {
+		t.Fatal("expected an error for an unknown scheme")
+	}
+	if got := dark.row(KindSession, true); got != "96;1;7" {
+		t.Fatalf("selected session row code=%q", got)
+	}
+	mono := themes["mono"]
+	if mono.row(KindGitRepo, false) != "" || mono.row(KindGitRepo, true) != "1" {
+		t.Fatal("mono should only embolden the selected row")
+	}
+	if got := paint("x", mono.row(KindBookmark, false), true); got != "x" {
+		t.Fatalf("empty code should leave text plain, got %q", got)
+	}
+}
+
+func TestPrintItemsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printItemsJSON(&buf, nil); err != nil || strings.TrimSpace(buf.String()) != "[]" {
+		t.Fatalf("empty list should print [], got %q (%v)", buf.String(), err)
+	}
+	buf.Reset()
+	items := []Item{{Kind: KindSession, Name: "util"}, {Kind: KindGitRepo, Name: "code_api", Path: "/code/api"}}
+	if err := printItemsJSON(&buf, items); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1]["kind"] != "G" || got[1]["name"] != "code_api" || got[1]["path"] != "/code/api" {
+		t.Fatalf("unexpected JSON: %s", buf.String())
+	}
+}
+
+func TestTraceConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(path, []byte("max_depth: 5\n"), 0o644)
+	var buf bytes.Buffer
+	if err := traceConfig(&buf, Options{ConfigPath: path, NoGit: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"1. Defaults\n",
+		"2. Config file: " + path + " (from -config flag) loaded\n   max_depth: 5\n",
+		"5. Command-line overrides\n   disable_git_checks: true\n",
+		"6. Final config\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("trace lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunNew(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	dir := filepath.Join(t.TempDir(), "code", "api")
+	_ = os.MkdirAll(dir, 0o755)
+	fake := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "svc"): errors.New("no"),
+	}}
+	shell = fake
+	t.Setenv("TMUX", "/tmp/tmux-0/default,1,0")
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if err := runNew(Options{}, []string{filepath.Join(dir, "missing")}); err == nil {
+		t.Fatal("expected an error for a missing path")
+	}
+	if err := runNew(Options{}, []string{"-name", "svc", dir}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		k("tmux", "has-session", "-t", "svc"),
+		k("tmux", "new-session", "-ds", "svc", "-c", dir),
+		k("tmux", "switch-client", "-t", "svc"),
+	}
+	if !slices.Equal(fake.calls, want) {
+		t.Fatalf("calls=%q want %q", fake.calls, want)
+	}
+}
+
+func TestWaitForSession(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	fake := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "later"): errors.New("no"),
+	}}
+	shell = fake
+
+	if _, ok := waitForSession("up", time.Second, 10*time.Millisecond); !ok {
+		t.Fatal("existing session should be found at once")
+	}
+	waited, ok := waitForSession("later", 50*time.Millisecond, 10*time.Millisecond)
+	if ok || waited < 50*time.Millisecond {
+		t.Fatalf("expected a timeout after 50ms, got ok=%v after %s", ok, waited)
+	}
+	if n := len(fake.calls); n < 3 {
+		t.Fatalf("expected repeated polling, got %d checks", n)
+	}
+
+	// The flag may follow the session name, as in `tsm wait api --timeout 30s`.
+	var err error
+	out := captureStdout(t, func() { err = runWait(Options{}, []string{"up", "--timeout", "1s"}) })
+	if err != nil || !strings.HasPrefix(out, "up is up after ") {
+		t.Fatalf("flag after the name: %v, %q", err, out)
+	}
+	started := time.Now()
+	if err := runWait(Options{}, []string{"later", "-timeout", "50ms"}); !errors.Is(err, exitStatus(1)) || time.Since(started) > 5*time.Second {
+		t.Fatalf("expected exit 1 after the 50ms timeout, got %v after %s", err, time.Since(started))
+	}
+	if err := runWait(Options{}, []string{"up", "-timeout", "1s", "extra"}); !errors.Is(err, exitStatus(2)) {
+		t.Fatalf("extra argument: got %v, want exit 2", err)
+	}
+}
+
+func TestFuzzyModes(t *testing.T) {
+	items := []Item{
+		{Kind: KindGitRepo, Name: "code_api", Path: "/code/api"},
+		{Kind: KindGitRepo, Name: "capi", Path: "/x/capi"},
+		{Kind: KindSession, Name: "Cargo"},
+	}
+	names := func(m MatchOptions, q string) []string {
+		var out []string
+		for _, v := range filterAndRank(items, q, 0, m) {
+			out = append(out, v.Name)
+		}
+		slices.Sort(out)
+		return out
+	}
+	if got := names(MatchOptions{}, "cai"); !slices.Equal(got, []string{"capi", "code_api"}) {
+		t.Fatalf("subsequence: %v", got)
+	}
+	if got := names(MatchOptions{Mode: FuzzyModeExact}, "api"); !slices.Equal(got, []string{"capi", "code_api"}) {
+		t.Fatalf("exact: %v", got)
+	}
+	if got := names(MatchOptions{Mode: FuzzyModePrefix}, "ca"); !slices.Equal(got, []string{"Cargo", "capi"}) {
+		t.Fatalf("prefix: %v", got)
+	}
+	if got := names(MatchOptions{Mode: FuzzyModePrefix, CaseSensitive: true}, "Ca"); !slices.Equal(got, []string{"Cargo"}) {
+		t.Fatalf("case-sensitive prefix: %v", got)
+	}
+	if _, err := parseFuzzyMode("regex"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
+
+func TestSplitShellWords(t *testing.T) {
+	cases := map[string][]string{
+		`-v`:                  {"-v"},
+		`  -L  work `:         {"-L", "work"},
+		`-f '/tmp/my conf'`:   {"-f", "/tmp/my conf"},
+		`-S "/tmp/a \"b\" c"`: {"-S", `/tmp/a "b" c`},
+		`-S /tmp/x\ y`:        {"-S", "/tmp/x y"},
+		`-L''work`:            {"-Lwork"},
+		`""`:                  {""},
+	}
+	for in, want := range cases {
+		got, err := splitShellWords(in)
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf("splitShellWords(%q)=%q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{`-f 'open`, `-f "open`, `trailing\`} {
+		if _, err := splitShellWords(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+
+	e := execShell{TmuxArgs: []string{"-L", "work"}}
+	if got := e.argv("tmux", []string{"ls"}); !slices.Equal(got, []string{"-L", "work", "ls"}) {
+		t.Fatalf("tmux argv=%q", got)
+	}
+	if got := e.argv("git", []string{"status"}); !slices.Equal(got, []string{"status"}) {
+		t.Fatalf("non-tmux commands must be left alone: %q", got)
+	}
+}
+
+func TestLsOutputs(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{out: map[string][]byte{
+		k("tmux", "list-sessions", "-F", "#{session_name}\t#{session_attached}"): []byte("work\t1\nidle\t0\n"),
+	}}
+	items := []Item{{Kind: KindSession, Name: "work"}, {Kind: KindSession, Name: "idle"}, {Kind: KindGitRepo, Name: "code_api", Path: "/code/api"}}
+	entries := lsEntries(items, attachedSessions(context.Background()))
+
+	var buf bytes.Buffer
+	if err := writeLs(&buf, entries, "table"); err != nil {
+		t.Fatal(err)
+	}
+	want := "KIND  NAME      PATH       STATUS\nS     work                 active\nS     idle                 inactive\nG     code_api  /code/api  \n"
+	if buf.String() != want {
+		t.Fatalf("table:\n%q\nwant\n%q", buf.String(), want)
+	}
+	buf.Reset()
+	_ = writeLs(&buf, entries, "plain")
+	if buf.String() != "work\nidle\ncode_api\n" {
+		t.Fatalf("plain: %q", buf.String())
+	}
+	buf.Reset()
+	_ = writeLs(&buf, entries, "json")
+	var got []map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil || got[0]["status"] != "active" || got[2]["path"] != "/code/api" {
+		t.Fatalf("json: %s (%v)", buf.String(), err)
+	}
+	if _, ok := got[2]["status"]; ok {
+		t.Fatal("directories should have no status")
+	}
+	if err := writeLs(&buf, entries, "yaml"); err == nil {
+		t.Fatal("expected an error for an unknown output")
+	}
+}
+
+func TestNewLayoutCreatesNamedWindows(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	if _, err := parseLayoutWindowSpec("nocolon"); err == nil {
+		t.Fatal("expected an error for a spec without a path")
+	}
+	if _, err := parseLayoutWindowSpec("x:" + filepath.Join(a, "missing")); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+	mainWin, err := parseLayoutWindowSpec("main:" + a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, _ := parseLayoutWindowSpec("api:" + b)
+
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "proj"): errors.New("no")}}
+	shell = f
+	if err := createLayoutSession(context.Background(), Config{}, "proj", []layoutWindowSpec{mainWin, api}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		k("tmux", "has-session", "-t", "proj"),
+		k("tmux", "new-session", "-ds", "proj", "-c", a),
+		k("tmux", "rename-window", "-t", "proj:^", "main"),
+		k("tmux", "new-window", "-t", "proj", "-c", b, "-n", "api"),
+		k("tmux", "select-window", "-t", "proj:^"),
+	}
+	if !slices.Equal(f.calls, want) {
+		t.Fatalf("calls:\n%q\nwant\n%q", f.calls, want)
+	}
+
+	// an existing session is only switched to
+	f = &fakeShell{}
+	shell = f
+	if err := createLayoutSession(context.Background(), Config{}, "proj", []layoutWindowSpec{mainWin, api}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 1 {
+		t.Fatalf("existing session should not be changed: %q", f.calls)
+	}
+}
+
+func TestCreateHooksGetSessionEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run through cmd /C on Windows")
+	}
+	old := shell
+	defer func() { shell = old }()
+	cfg := Config{Hooks: Hooks{PreCreate: []string{"pre1", "pre2"}, PostCreate: []string{"post"}}}
+	env := []string{"TSM_SESSION=proj", "TSM_DIR=/code/proj"}
+	hook := func(c string) string { return k("env", append(slices.Clone(env), "sh", "-c", c)...) }
+
+	f := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "proj"): errors.New("no"),
+		hook("post"):                           errors.New("exit 1"),
+	}}
+	shell = f
+	_, created, err := createSessionForDir(context.Background(), cfg, "proj", "/code/proj")
+	if err != nil || !created {
+		t.Fatalf("created=%v err=%v (a post_create failure is not fatal)", created, err)
+	}
+	want := []string{
+		k("tmux", "has-session", "-t", "proj"),
+		hook("pre1"), hook("pre2"),
+		k("tmux", "new-session", "-ds", "proj", "-c", "/code/proj"),
+		hook("post"),
+	}
+	if !slices.Equal(f.calls, want) {
+		t.Fatalf("calls:\n%q\nwant\n%q", f.calls, want)
+	}
+
+	f = &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "proj"): errors.New("no"),
+		hook("pre1"):                           errors.New("exit 1"),
+	}}
+	shell = f
+	if _, _, err := createSessionForDir(context.Background(), cfg, "proj", "/code/proj"); err == nil {
+		t.Fatal("a failing pre_create hook should abort")
+	}
+	if slices.Contains(f.calls, k("tmux", "new-session", "-ds", "proj", "-c", "/code/proj")) || slices.Contains(f.calls, hook("pre2")) {
+		t.Fatalf("nothing should run after a failing pre_create hook: %q", f.calls)
+	}
+
+	// -no-attach and -startup-layout sessions get the hooks too
+	for name, create := range map[string]func() error{
+		"createDetached": func() error {
+			return createDetached(context.Background(), cfg, Item{Kind: KindGitRepo, Name: "proj", Path: "/code/proj"})
+		},
+		"startSessions": func() error {
+			return startSessions(context.Background(), cfg, StartupLayout{Sessions: []StartupSession{{Name: "proj", Path: "/code/proj"}}})
+		},
+	} {
+		f = &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "proj"): errors.New("no")}}
+		shell = f
+		var err error
+		captureStdout(t, func() { err = create() })
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !slices.Contains(f.calls, hook("pre1")) || !slices.Contains(f.calls, hook("post")) {
+			t.Fatalf("%s skipped the create hooks: %q", name, f.calls)
+		}
+	}
+}
+
+func TestKillIdleSessions(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	now := time.Unix(1_000_000, 0)
+	ago := func(d time.Duration) string { return strconv.FormatInt(now.Add(-d).Unix(), 10) }
+	format := "#{session_attached} #{session_last_attached} #{session_created}"
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "list-sessions", "-F", "#S"):                    []byte("busy\nfresh\nnever\nold\n"),
+		k("tmux", "display-message", "-t", "old", "-p", format):   []byte("0 " + ago(3*time.Hour) + " " + ago(5*time.Hour) + "\n"),
+		k("tmux", "display-message", "-t", "fresh", "-p", format): []byte("0 " + ago(time.Hour) + " " + ago(5*time.Hour) + "\n"),
+		k("tmux", "display-message", "-t", "busy", "-p", format):  []byte("1 " + ago(9*time.Hour) + " " + ago(9*time.Hour) + "\n"),
+		k("tmux", "display-message", "-t", "never", "-p", format): []byte("0  " + ago(30*time.Minute) + "\n"),
+	}}
+	shell = f
+	killIdleSessions(context.Background(), 2*time.Hour, now)
+	var killed []string
+	for _, c := range f.calls {
+		if s, ok := strings.CutPrefix(c, k("tmux", "kill-session", "-t")+" "); ok {
+			killed = append(killed, s)
+		}
+	}
+	if !slices.Equal(killed, []string{"old"}) {
+		t.Fatalf("killed %q, want only old", killed)
+	}
+}
+
+func TestTimeoutPrefersFlagOverConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if got := resolveTimeout(0, ""); got != defaultTimeout {
+		t.Fatalf("no config: got %s, want %s", got, defaultTimeout)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("timeout: 30s\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolveTimeout(0, path); got != 30*time.Second {
+		t.Fatalf("config timeout: got %s", got)
+	}
+	if got := resolveTimeout(2*time.Second, path); got != 2*time.Second {
+		t.Fatalf("-timeout should win: got %s", got)
+	}
+	if got := (Options{}).timeout(); got != defaultTimeout {
+		t.Fatalf("zero Timeout: got %s, want %s", got, defaultTimeout)
+	}
+	// Reloading the config must not change the run's timeout.
+	opts := Options{ConfigPath: path, Timeout: resolveTimeout(0, path)}
+	if err := os.WriteFile(path, []byte("timeout: 1s\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRunConfig(opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := opts.timeout(); got != 30*time.Second {
+		t.Fatalf("after reload: got %s, want 30s", got)
+	}
+	if err := os.WriteFile(path, []byte("timeout: -1s\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRunConfig(Options{ConfigPath: path}); err == nil {
+		t.Fatal("expected an error for a negative timeout")
+	}
+}
+
+func TestRenameBatch(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "api"):  errors.New("no"),
+		k("tmux", "has-session", "-t", "gone"): errors.New("no"),
+	}}
+	shell = f
+	if err := appendHistory(Item{Kind: KindSession, Name: "a_api"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{
+		{"old_name", "new_name"},
+		{"a_api", "api"},
+		{"gone", "x"},
+		{"web", "taken"},
+		{"bad"},
+	}
+	var w bytes.Buffer
+	renamed, failed := renameBatch(context.Background(), &w, rows)
+	if !slices.Equal(renamed, []sessionRename{{Old: "a_api", New: "api"}}) || failed != 2 {
+		t.Fatalf("renamed=%v failed=%d\n%s", renamed, failed, w.String())
+	}
+	if !strings.Contains(w.String(), "warning: gone") || !strings.Contains(w.String(), "error: web -> taken") {
+		t.Fatalf("messages:\n%s", w.String())
+	}
+	if !slices.Contains(f.calls, k("tmux", "rename-session", "-t", "a_api", "api")) {
+		t.Fatalf("calls: %q", f.calls)
+	}
+	if err := renameHistory(renamed); err != nil {
+		t.Fatal(err)
+	}
+	hist, _ := loadHistory()
+	if len(hist) != 1 || hist[0].Name != "api" {
+		t.Fatalf("history: %+v", hist)
+	}
+
+	// Chained renames apply in row order: a -> b, then b -> c.
+	chain := []sessionRename{{Old: "api", New: "b"}, {Old: "b", New: "c"}}
+	if err := renameHistory(chain); err != nil {
+		t.Fatal(err)
+	}
+	if hist, _ := loadHistory(); len(hist) != 1 || hist[0].Name != "c" {
+		t.Fatalf("chained history: %+v", hist)
+	}
+	if err := saveLinks(map[string]string{"api": "/src/api"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameLinks(chain); err != nil {
+		t.Fatal(err)
+	}
+	if links, _ := loadLinks(); !maps.Equal(links, map[string]string{"c": "/src/api"}) {
+		t.Fatalf("chained links: %v", links)
+	}
+}
+
+func TestSSHConfigHosts(t *testing.T) {
+	conf := `# comment
+Host github.com
+  HostName github.com
+Host=box  jump
+host *.internal !bad db?
+Match host foo
+Host box
+`
+	hosts, err := parseSSHHosts(strings.NewReader(conf))
+	if err != nil || !slices.Equal(hosts, []string{"github.com", "box", "jump"}) {
+		t.Fatalf("hosts=%q err=%v", hosts, err)
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	_ = os.MkdirAll(filepath.Join(home, ".ssh"), 0o700)
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	items := sshItems()
+	if len(items) != 3 || items[1] != (Item{Kind: KindBookmark, Name: "ssh_box", Path: "ssh://box"}) {
+		t.Fatalf("items: %+v", items)
+	}
+
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "ssh_box"): errors.New("no")}}
+	shell = f
+	if _, _, err := createSessionForDir(context.Background(), Config{}, "ssh_box", "ssh://box"); err != nil {
+		t.Fatal(err)
+	}
+	if want := k("tmux", "new-session", "-ds", "ssh_box", "ssh 'box'"); !slices.Contains(f.calls, want) {
+		t.Fatalf("calls %q, want %q", f.calls, want)
+	}
+}
+
+func TestLockSession(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "list-sessions", "-F", "#{session_name}\t#{@tsm-locked}"): []byte("docs\t1\nwork\t\n"),
+	}}
+	shell = f
+	if err := runLock(Options{}, []string{"docs"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		k("tmux", "set-option", "-t", "docs", "remain-on-exit", "on"),
+		k("tmux", "set-option", "-t", "docs", "@tsm-locked", "1"),
+		k("tmux", "lock-session", "-t", "docs"),
+	} {
+		if !slices.Contains(f.calls, want) {
+			t.Fatalf("missing %q in %q", want, f.calls)
+		}
+	}
+	if got := lockedSessions(context.Background()); !maps.Equal(got, map[string]bool{"docs": true}) {
+		t.Fatalf("locked: %v", got)
+	}
+	if err := runUnlock(Options{}, []string{"docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(f.calls, k("tmux", "set-option", "-t", "docs", "-u", "@tsm-locked")) {
+		t.Fatalf("unlock calls: %q", f.calls)
+	}
+}
+
+func TestThemeConfigOverScheme(t *testing.T) {
+	base, _ := lookupTheme("dark")
+	got, err := Theme{SessionColor: "cyan", RepoColor: "1;32", SelectedBG: "Blue"}.over(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := base
+	want.Session, want.Repo, want.Selected = "36", "1;32", "44"
+	if got != want {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+	if _, err := (Theme{BookmarkColor: "ochre"}).over(base); err == nil || !strings.Contains(err.Error(), "theme.bookmark_color") {
+		t.Fatalf("expected a theme.bookmark_color error, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("theme:\n  session_color: 36\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil || cfg.Theme.SessionColor != "36" {
+		t.Fatalf("unquoted SGR code not loaded: %+v %v", cfg.Theme, err)
+	}
+}
+
+func TestWatchSessionAttachesReadOnly(t *testing.T) {
+	t.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "display-message", "-p", "-t", "build", "#{pane_index}"): []byte("0\n"),
+	}}
+	shell = f
+	if err := runWatchSession(Options{}, []string{"-pane", "2", "build"}); err != nil {
+		t.Fatal(err)
+	}
+	// the previously active pane is selected again after the detach
+	want := []string{k("tmux", "attach", "-r", "-t", "build:.2"), k("tmux", "select-pane", "-t", "build:.0")}
+	if n := len(f.calls); n < 2 || !slices.Equal(f.calls[n-2:], want) {
+		t.Fatalf("calls %q, want %q last", f.calls, want)
+	}
+	if os.Getenv("TMUX") != "" {
+		t.Fatal("TMUX should be unset for the nested attach")
+	}
+	if got := watchTarget("build", -1); got != "build" {
+		t.Fatalf("watchTarget: %q", got)
+	}
+}
+
+func TestSwitchByName(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	root := t.TempDir()
+	repo := filepath.Join(root, "code", "myproject")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{ScanPaths: []string{root}, MaxDepth: 3, ProjectMarkers: []string{".git"}, DisableGitChecks: true}
+
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{}
+	shell = f
+	if _, err := switchByName(context.Background(), cfg, "work", false, true); err != nil {
+		t.Fatal(err)
+	}
+	if f.calls[len(f.calls)-1] != k("tmux", "switch-client", "-t", "work") {
+		t.Fatalf("existing session: %q", f.calls)
+	}
+
+	f = &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", "code"):           errors.New("no"),
+		k("tmux", "has-session", "-t", "code_myproject"): errors.New("no"),
+	}}
+	shell = f
+	it, err := switchByName(context.Background(), cfg, "code", false, true)
+	if err != nil || it.Name != "code_myproject" {
+		t.Fatalf("prefix match: %+v, %v", it, err)
+	}
+	if !slices.Contains(f.calls, k("tmux", "new-session", "-ds", "code_myproject", "-c", repo)) {
+		t.Fatalf("expected the session to be created: %q", f.calls)
+	}
+	if _, err := switchByName(context.Background(), cfg, "code", true, true); err == nil {
+		t.Fatal("-exact should not accept a prefix")
+	}
+}
+
+func TestRankDebouncerRanksLastQueryOnce(t *testing.T) {
+	var mu sync.Mutex
+	var ranked []string
+	rank := func(items []Item, q string) []viewItem {
+		mu.Lock()
+		ranked = append(ranked, q)
+		mu.Unlock()
+		return filterAndRank(items, q, 30, MatchOptions{})
+	}
+	d := newRankDebouncer(20*time.Millisecond, rank)
+	defer d.stop()
+	items := []Item{{Kind: KindGitRepo, Name: "alpha"}, {Kind: KindGitRepo, Name: "beta"}}
+	for _, q := range []string{"b", "be", "bet"} {
+		d.schedule(items, q)
+	}
+	select {
+	case res := <-d.C:
+		if res.query != "bet" || len(res.cands) != 1 || res.cands[0].Name != "beta" {
+			t.Fatalf("result: %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no result")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(ranked, []string{"bet"}) {
+		t.Fatalf("ranked %q, want only the last query", ranked)
+	}
+}
+
+func TestMoveSessionRecreatesOnTarget(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{
+		out: map[string][]byte{
+			k("tmux", "list-windows", "-t", "api", "-F", "#{window_index}\t#{window_name}\t#{window_layout}"): []byte("1\tedit\tb25d,80x24,0,0,1\n2\tlogs\tc3a1,80x24,0,0{40x24,0,0,2,39x24,41,0,3}\n"),
+			k("tmux", "list-panes", "-s", "-t", "api", "-F", "#{window_index}\t#{pane_current_path}"):         []byte("1\t/code/api\n2\t/var/log\n2\t/code/api/tmp\n"),
+		},
+		err: map[string]error{k("tmux", "-L", "work", "has-session", "-t", "api"): errors.New("no")},
+	}
+	shell = f
+	oldIn := stdinLines
+	defer func() { stdinLines = oldIn }()
+	stdinLines = bufio.NewReader(strings.NewReader("n\n"))
+	out := captureStdout(t, func() {
+		if err := runMoveSession(Options{}, []string{"-socket", "work", "api"}); err != nil {
+			t.Error(err)
+		}
+	})
+	if slices.Contains(f.calls, k("tmux", "kill-session", "-t", "api")) {
+		t.Fatalf("source killed without confirmation: %q", f.calls)
+	}
+	if !strings.Contains(out, "not moved") || !strings.Contains(out, "Kill api on the current server? [y/N]") {
+		t.Fatalf("output:\n%s", out)
+	}
+
+	f.calls = nil
+	captureStdout(t, func() {
+		if err := runMoveSession(Options{}, []string{"-socket", "work", "-yes", "api"}); err != nil {
+			t.Error(err)
+		}
+	})
+	want := []string{
+		k("tmux", "-L", "work", "new-session", "-ds", "api", "-c", "/code/api", "-n", "edit"),
+		k("tmux", "-L", "work", "new-window", "-t", "api", "-c", "/var/log", "-n", "logs"),
+		k("tmux", "-L", "work", "split-window", "-t", "api", "-c", "/code/api/tmp"),
+		k("tmux", "-L", "work", "select-layout", "-t", "api", "c3a1,80x24,0,0{40x24,0,0,2,39x24,41,0,3}"),
+		k("tmux", "-L", "work", "select-window", "-t", "api:^"),
+		k("tmux", "kill-session", "-t", "api"),
+	}
+	i := slices.Index(f.calls, want[0])
+	if i < 0 || !slices.Equal(f.calls[i:], want) {
+		t.Fatalf("calls:\n%q\nwant suffix\n%q", f.calls, want)
+	}
+
+	f.err = nil // the session now "exists" on the target too
+	if err := runMoveSession(Options{}, []string{"-socket", "work", "api"}); !errors.Is(err, ErrSessionExists) {
+		t.Fatalf("expected ErrSessionExists, got %v", err)
+	}
+}
+
+func TestInputFileOpensEachPath(t *testing.T) {
+	root := t.TempDir()
+	api := filepath.Join(root, "code", "api")
+	web := filepath.Join(root, "code", "web")
+	for _, d := range []string{api, web} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := filepath.Join(root, "repos.txt")
+	content := "# workspace\n" + api + "\n\n" + web + "\n" + filepath.Join(root, "missing") + "\n"
+	if err := os.WriteFile(list, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := readInputFile(list)
+	if err != nil || len(paths) != 3 {
+		t.Fatalf("paths=%q err=%v", paths, err)
+	}
+
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "code_api"): errors.New("no")}}
+	var w bytes.Buffer
+	sessions, failed := openInputPaths(time.Second, Config{}, &w, paths)
+	if !slices.Equal(sessions, []string{"code_api", "code_web"}) || failed != 1 {
+		t.Fatalf("sessions=%q failed=%d", sessions, failed)
+	}
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "created code_api") ||
+		!strings.HasSuffix(lines[1], "exists code_web") || !strings.Contains(lines[2], "error:") {
+		t.Fatalf("report:\n%s", w.String())
+	}
+
+	// A path that runs out of time must not use up the next path's time.
+	shell = &slowShell{
+		fakeShell: &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "code_api"): errors.New("no")}},
+		slow:      k("tmux", "new-session", "-ds", "code_api"),
+		delay:     50 * time.Millisecond,
+	}
+	w.Reset()
+	sessions, failed = openInputPaths(20*time.Millisecond, Config{}, &w, paths[:2])
+	if !slices.Equal(sessions, []string{"code_web"}) || failed != 1 {
+		t.Fatalf("sessions=%q failed=%d\n%s", sessions, failed, w.String())
+	}
+}
+
+// slowShell is a fakeShell whose commands starting with slow take delay,
+// and whose commands fail once their context is done.
+type slowShell struct {
+	*fakeShell
+	slow  string
+	delay time.Duration
+}
+
+func (s *slowShell) wait(ctx context.Context, key string) error {
+	if strings.HasPrefix(key, s.slow) {
+		time.Sleep(s.delay)
+	}
+	return ctx.Err()
+}
+func (s *slowShell) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if err := s.wait(ctx, k(name, args...)); err != nil {
+		return nil, err
+	}
+	return s.fakeShell.Output(ctx, name, args...)
+}
+func (s *slowShell) Run(ctx context.Context, name string, args ...string) error {
+	if err := s.wait(ctx, k(name, args...)); err != nil {
+		return err
+	}
+	return s.fakeShell.Run(ctx, name, args...)
+}
+
+func TestPagerCommandSplitsWords(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("PAGER", "")
+	if p, _ := pagerCommand(); !slices.Equal(p, []string{"less"}) {
+		t.Fatalf("fallback pager: %q", p)
+	}
+	t.Setenv("PAGER", "less -R")
+	log, err := recordingPath("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(log), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(log, []byte("output\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{}
+	shell = f
+	if err := runReplay(Options{}, []string{"-view", "api"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{k("less", "-R", log)}; !slices.Equal(f.calls, want) {
+		t.Fatalf("calls %q, want %q", f.calls, want)
+	}
+	t.Setenv("PAGER", "less 'unterminated")
+	if err := pageText("x"); err == nil {
+		t.Fatal("expected an error for an unbalanced $PAGER")
+	}
+}
+
+func TestEditConfigCreatesAndValidates(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("EDITOR", "")
+	t.Setenv("VISUAL", "code -w")
+	if ed, _ := editorCommand(); !slices.Equal(ed, []string{"code", "-w"}) {
+		t.Fatalf("editor: %q", ed)
+	}
+	t.Setenv("VISUAL", "")
+	if ed, _ := editorCommand(); !slices.Equal(ed, []string{"vi"}) {
+		t.Fatalf("fallback editor: %q", ed)
+	}
+
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{}
+	shell = f
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := runEditConfig(Options{ConfigPath: path}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("config should be created: %v", err)
+	}
+	if want := k("vi", path); !slices.Equal(f.calls, []string{want}) {
+		t.Fatalf("calls %q, want %q", f.calls, want)
+	}
+
+	if err := os.WriteFile(path, []byte("scan_paths: [unclosed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runEditConfig(Options{ConfigPath: path}, nil); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	for _, c := range []struct{ limit, rows, want int }{
+		{30, 0, 30},  // height unknown
+		{30, 24, 19}, // 24 rows minus 5 header lines
+		{10, 50, 10},
+		{30, 4, 30}, // too small to matter
+	} {
+		if got := resultLimit(c.limit, c.rows); got != c.want {
+			t.Fatalf("resultLimit(%d, %d) = %d, want %d", c.limit, c.rows, got, c.want)
+		}
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("max_results: 50\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadRunConfig(Options{ConfigPath: path})
+	if err != nil || cfg.MaxResults != 50 {
+		t.Fatalf("max_results: %d, %v", cfg.MaxResults, err)
+	}
+	if cfg, _ = loadRunConfig(Options{ConfigPath: path, MaxResults: 8}); cfg.MaxResults != 8 {
+		t.Fatalf("-max should win: %d", cfg.MaxResults)
+	}
+	_ = os.WriteFile(path, []byte("scan_paths: [/tmp]\n"), 0o644)
+	if cfg, _ = loadRunConfig(Options{ConfigPath: path}); cfg.MaxResults != defaultMaxResults {
+		t.Fatalf("default: %d", cfg.MaxResults)
+	}
+}
+
+func TestPinWindow(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "list-windows", "-t", "api", "-F", "#{window_index}\t#{window_name}\t#{@tsm-pinned}"): []byte("1\teditor\t\n2\tserver\t1\n"),
+	}}
+	shell = f
+	if err := runPinWindow(Options{}, []string{"api:server"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		k("tmux", "set-window-option", "-t", "api:2", "remain-on-exit", "on"),
+		k("tmux", "set-window-option", "-t", "api:2", "@tsm-pinned", "1"),
+	} {
+		if !slices.Contains(f.calls, want) {
+			t.Fatalf("missing %q in %q", want, f.calls)
+		}
+	}
+	if err := runUnpinWindow(Options{}, []string{"api:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(f.calls, k("tmux", "set-window-option", "-t", "api:1", "-u", "remain-on-exit")) {
+		t.Fatalf("unpin calls: %q", f.calls)
+	}
+	if err := runPinWindow(Options{}, []string{"api"}); err == nil {
+		t.Fatal("expected a usage error without a window")
+	}
+	wins, _ := listWindows(context.Background(), "api")
+	if len(wins) != 2 || wins[0].Pinned || !wins[1].Pinned {
+		t.Fatalf("windows: %+v", wins)
+	}
+}
+
+// tmuxTarget builds "<session>:<window>" the way tmux sees it: tmux stores
+// "." and ":" in session names as "_", since both split a target.
+func tmuxTarget(sess, win string) string {
+	return strings.NewReplacer(".", "_", ":", "_").Replace(sess) + ":" + win
+}
+
+func TestSessionNameMaxLen(t *testing.T) {
+	cases := []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{"short_name", 24, "short_name"},
+		{"my-very-long-parent-directory_my-very-long-project-name", 24, "my-very-long-parent-dir_"},
+		{"abcdefgh_ijkl", 10, "abcdefgh_"}, // no doubled "_"
+		{"abcdefgh_ijkl", 0, "abcdefgh_ijkl"},
+	}
+	for _, c := range cases {
+		got := truncateSessionName(c.name, c.limit)
+		if got != c.want || (c.limit > 0 && len(got) > c.limit) {
+			t.Fatalf("truncateSessionName(%q, %d) = %q, want %q", c.name, c.limit, got, c.want)
+		}
+		if sanitize(got) != got {
+			t.Fatalf("%q is not a sanitize-valid name", got)
+		}
+		if sess, win, _ := strings.Cut(tmuxTarget(got, "1"), ":"); sess != got || win != "1" {
+			t.Fatalf("%q does not round-trip through a tmux target: %q %q", got, sess, win)
+		}
+	}
+
+	defer sessionNameMaxLen.Store(0)
+	if err := useSessionNameMaxLen(Config{SessionNameMaxLen: 1}); err == nil {
+		t.Fatal("expected an error for a limit without room for the name")
+	}
+	if err := useSessionNameMaxLen(Config{SessionNameMaxLen: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionNameFromPath("/code/parentdir/project"); got != "parentdir_" {
+		t.Fatalf("sessionNameFromPath: %q", got)
+	}
+}
+
+func TestExcludeGlobsPruneScan(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"keep", "old.bak", "tmp_1", "tmp_build", "cache7", "cache10", "__pycache__", "nested/x.bak/deep"} {
+		if err := os.MkdirAll(filepath.Join(root, d, ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := Config{
+		ScanPaths:      []string{root},
+		MaxDepth:       4,
+		Exclude:        []string{"*.bak", "tmp_*", "cache?", "__pycache__", "[bad"},
+		ProjectMarkers: []string{".git"},
+	}
+	got := scanGitReposConcurrent(cfg)
+	want := []string{filepath.Join(root, "cache10"), filepath.Join(root, "keep")}
+	if !slices.Equal(got, want) {
+		t.Fatalf("repos %q, want %q", got, want)
+	}
+	e := newExcludeSet(cfg.Exclude)
+	if !e.match("[bad") || e.match("bad") {
+		t.Fatal("a malformed pattern should only match itself")
+	}
+}
+
+func TestNewWindowHere(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{}
+	shell = f
+
+	t.Setenv("TMUX", "")
+	if err := runNewWindowHere(Options{}, nil); err == nil {
+		t.Fatal("expected an error outside tmux")
+	}
+	if len(f.calls) != 0 {
+		t.Fatalf("ran tmux outside tmux: %v", f.calls)
+	}
+
+	t.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+	t.Setenv("PWD", "/code/my api")
+	if err := runNewWindowHere(Options{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{k("tmux", "new-window", "-c", "/code/my api", "-n", sanitize("my api"))}
+	if !slices.Equal(f.calls, want) {
+		t.Fatalf("calls %q, want %q", f.calls, want)
+	}
+}
+
+func TestGenerateMakefile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{out: map[string][]byte{
+		k("tmux", "display-message", "-t", "api", "-p", "#{session_path}"): []byte("/code/api\n"),
+	}}
+	if err := runGenerateMakefile(Options{}, []string{"api"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("Makefile.tsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"TSM_SESSION ?= api\n", "TSM_DIR ?= /code/api\n", "\n\t$(TSM) new -name '$(TSM_SESSION)' '$(TSM_DIR)'\n", "\n\ttmux kill-session -t '$(TSM_SESSION)'\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("Makefile.tsm lacks %q:\n%s", want, data)
+		}
+	}
+
+	if err := os.WriteFile("Makefile", []byte("build:\n\tgo build\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGenerateMakefile(Options{}, []string{"-append", "api"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile("Makefile")
+	if !strings.HasPrefix(string(data), "build:\n\tgo build\n\n# tsm targets") {
+		t.Fatalf("Makefile:\n%s", data)
+	}
+
+	// Appending again replaces the tsm targets instead of repeating them.
+	if err := os.WriteFile("Makefile", append(data, "test:\n\tgo test\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	shell = &fakeShell{out: map[string][]byte{
+		k("tmux", "display-message", "-t", "web", "-p", "#{session_path}"): []byte("/code/web\n"),
+	}}
+	if err := runGenerateMakefile(Options{}, []string{"-append", "web"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile("Makefile")
+	if strings.Count(string(data), "\nopen:") != 1 || !strings.Contains(string(data), "TSM_SESSION ?= web\n") ||
+		!strings.HasPrefix(string(data), "build:\n") || !strings.HasSuffix(string(data), "\ntest:\n\tgo test\n") {
+		t.Fatalf("Makefile after a second -append:\n%s", data)
+	}
+
+	if err := os.WriteFile("Makefile", []byte("kill:\n\tpkill app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGenerateMakefile(Options{}, []string{"-append", "web"}); err == nil || !strings.Contains(err.Error(), "kill target") {
+		t.Fatalf("expected a kill target conflict, got %v", err)
+	}
+}
+
+func TestKillAll(t *testing.T) {
+	sessions := []string{"api", "api-old", "web", "work_notes"}
+	for pattern, want := range map[string][]string{
+		"":        sessions,
+		"api*":    {"api", "api-old"},
+		"w?b":     {"web"},
+		"wn":      {"work_notes"},
+		"nothing": nil,
+	} {
+		got, err := matchSessions(sessions, pattern, MatchOptions{})
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("matchSessions(%q) = %q, %v; want %q", pattern, got, err, want)
+		}
+	}
+	if _, err := matchSessions(sessions, "[", MatchOptions{}); err == nil {
+		t.Error("malformed glob accepted")
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "list-sessions", "-F", "#S"): []byte(strings.Join(sessions, "\n") + "\n"),
+	}}
+	shell = f
+	if err := runKillAll(Options{}, []string{"-yes", "api*"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{k("tmux", "kill-session", "-t", "api"), k("tmux", "kill-session", "-t", "api-old")}
+	var killed []string
+	for _, c := range f.calls {
+		if strings.HasPrefix(c, k("tmux", "kill-session")) {
+			killed = append(killed, c)
+		}
+	}
+	if !slices.Equal(killed, want) {
+		t.Fatalf("calls %q, want %q", killed, want)
+	}
+
+	// A confirmation slower than the timeout must not expire the kills.
+	f.calls = nil
+	shell = &slowShell{fakeShell: f, slow: k("tmux", "none")}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	oldIn := stdinLines
+	defer func() { stdinLines = oldIn }()
+	stdinLines = bufio.NewReader(pr)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = pw.Write([]byte("y\n"))
+	}()
+	captureStdout(t, func() {
+		if err := runKillAll(Options{Timeout: 20 * time.Millisecond}, []string{"web"}); err != nil {
+			t.Error(err)
+		}
+	})
+	if !slices.Contains(f.calls, k("tmux", "kill-session", "-t", "web")) {
+		t.Fatalf("calls %q", f.calls)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	now := time.Date(2024, 1, 15, 14, 32, 11, 0, time.Local)
+	hist := []HistoryEntry{
+		{Time: now.Add(-72 * time.Hour), Kind: KindSession, Name: "old"},
+		{Time: now.Add(-time.Hour), Kind: KindGitRepo, Name: "myorg_myrepo", Path: "/Code/myorg/myrepo"},
+		{Time: now, Kind: KindBookmark, Name: "notes", Path: "/notes"},
+	}
+	since, err := parseSince("2d", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filterHistory(hist, 0, since, ""); len(got) != 2 || got[0].Name != "myorg_myrepo" {
+		t.Fatalf("since 2d: %+v", got)
+	}
+	if got, _ := parseSince("2024-01-15", now); !got.Equal(time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("2024-01-15 parsed as %s", got)
+	}
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Fatal("parseSince accepted yesterday")
+	}
+	if got := filterHistory(hist, 1, time.Time{}, ""); len(got) != 1 || got[0].Name != "notes" {
+		t.Fatalf("limit 1: %+v", got)
+	}
+	if got := filterHistory(hist, 0, time.Time{}, KindSession); len(got) != 1 || got[0].Name != "old" {
+		t.Fatalf("kind S: %+v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := writeHistory(&buf, hist[1:2], false); err != nil {
+		t.Fatal(err)
+	}
+	if want := "2024-01-15 13:32:11  G  myorg_myrepo  /Code/myorg/myrepo\n"; buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+	buf.Reset()
+	if err := writeHistory(&buf, nil, true); err != nil || buf.String() != "[]\n" {
+		t.Fatalf("empty json: %q, %v", buf.String(), err)
+	}
+
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	for _, it := range []Item{
+		{Kind: KindWorktree, Name: "api_feature", Path: "/Code/api-feature"},
+		{Kind: KindProject, Name: "notes", Path: "/Code/notes"},
+	} {
+		if err := appendHistory(it); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for kind, want := range map[string]string{"w": "api_feature", "P": "notes"} {
+		out := captureStdout(t, func() {
+			if err := runHistory(Options{}, []string{"-kind", kind}); err != nil {
+				t.Error(err)
+			}
+		})
+		if strings.Count(out, "\n") != 1 || !strings.Contains(out, want) {
+			t.Fatalf("-kind %s:\n%s", kind, out)
+		}
+	}
+	if err := runHistory(Options{}, []string{"-kind", "X"}); err == nil {
+		t.Fatal("-kind X accepted")
+	}
+}
+
+func TestGroups(t *testing.T) {
+	t.Setenv("HOME", "/home/u")
+	groups, err := compileGroups(map[string][]string{
+		"work": {"~/Code/company/*"},
+		"oss":  {"*/ivuorinen/*", "/srv/*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []Item{
+		{Kind: KindGitRepo, Name: "company_api", Path: "/home/u/Code/company/api"},
+		{Kind: KindGitRepo, Name: "ivuorinen_tsm", Path: "/home/u/Code/ivuorinen/tsm"},
+		{Kind: KindBookmark, Name: "notes", Path: "/home/u/notes"},
+		{Kind: KindSession, Name: "scratch"},
+	}
+	assignGroups(items, groups)
+	var got []string
+	for _, it := range items {
+		got = append(got, it.Group)
+	}
+	if want := []string{"work", "oss", "", ""}; !slices.Equal(got, want) {
+		t.Fatalf("groups %q, want %q", got, want)
+	}
+	if f := filterByGroup(items, "work"); len(f) != 1 || f[0].Name != "company_api" {
+		t.Fatalf("filterByGroup(work) = %+v", f)
+	}
+	if f := filterByGroup(items, ""); len(f) != len(items) {
+		t.Fatalf("filterByGroup(\"\") dropped items: %+v", f)
+	}
+
+	labels := []string{"oss", "work"}
+	for cur, want := range map[string]string{"": "oss", "oss": "work", "work": ""} {
+		if got := nextGroup(labels, cur); got != want {
+			t.Errorf("nextGroup(%q) = %q, want %q", cur, got, want)
+		}
+	}
+	if _, err := compileGroups(map[string][]string{"bad": {"/x/[ab"}}); err == nil {
+		t.Fatal("unterminated [ accepted")
+	}
+}
+
+func TestRemoteWebURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"git@github.com:org/repo.git\n":           "https://github.com/org/repo",
+		"git@github.com:org/repo":                 "https://github.com/org/repo",
+		"ssh://git@gitlab.com:2222/grp/sub/r.git": "https://gitlab.com/grp/sub/r",
+		"https://github.com/org/repo.git":         "https://github.com/org/repo",
+		"https://user@example.com/org/repo/":      "https://example.com/org/repo",
+	} {
+		if got, err := remoteWebURL(in); err != nil || got != want {
+			t.Errorf("remoteWebURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"/srv/git/repo.git", "file:///srv/git/repo.git"} {
+		if got, err := remoteWebURL(in); err == nil {
+			t.Errorf("remoteWebURL(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "list-sessions", "-F", "#S"):                       []byte("api\n"),
+		k("git", "-C", "/code/api", "remote", "get-url", "upstream"): []byte("git@github.com:org/api.git\n"),
+	}}
+	shell = f
+	if err := saveLinks(Links{"api": "/code/api"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runOpenURL(Options{}, []string{"-remote", "upstream", "api"}); err != nil {
+		t.Fatal(err)
+	}
+	name, args := browserCommand("https://github.com/org/api")
+	if want := k(name, args...); f.calls[len(f.calls)-1] != want {
+		t.Fatalf("last call %q, want %q", f.calls[len(f.calls)-1], want)
+	}
+}
+
+func TestCollisionStrategy(t *testing.T) {
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{avail: map[string]bool{}}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	tmp := t.TempDir()
+	first := filepath.Join(tmp, "alice", "team", "app")
+	second := filepath.Join(tmp, "bob", "team", "app")
+	for _, d := range []string{first, second} {
+		if err := os.MkdirAll(filepath.Join(d, ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(strategy CollisionStrategy) map[string]string {
+		cfg := Config{ScanPaths: []string{tmp}, MaxDepth: 4, NoCache: true, CollisionStrategy: strategy}
+		got := map[string]string{}
+		for _, it := range buildItems(context.Background(), cfg) {
+			got[it.Path] = it.Name
+		}
+		return got
+	}
+	for _, s := range []CollisionStrategy{"", CollisionFirst, CollisionWarn} {
+		if got := names(s); len(got) != 2 || got[first] != "team_app" || got[second] != "team_app" {
+			t.Errorf("%q: got %v, want both paths as team_app", s, got)
+		}
+	}
+	alt := altSessionName("team_app", second)
+	if got := names(CollisionDisambiguate); got[first] != "team_app" || got[second] != alt {
+		t.Errorf("disambiguate: got %v, want %s for %s", got, alt, second)
+	}
+	if alt != altSessionName("team_app", second+"/") || alt == altSessionName("team_app", first) {
+		t.Errorf("altSessionName is not derived from the cleaned path: %s", alt)
+	}
+
+	// A session keeps its name for its own directory, whatever the order;
+	// the same path twice is not a collision.
+	if err := saveLinks(map[string]string{"w_x": "/b/w/x"}); err != nil {
+		t.Fatal(err)
+	}
+	items := []Item{
+		{Kind: KindSession, Name: "w_x", Path: "/b/w/x"},
+		{Kind: KindGitRepo, Name: "w_x", Path: "/a/w/x"},
+		{Kind: KindBookmark, Name: "w_x", Path: "/a/w/x"},
+		{Kind: KindGitRepo, Name: "w_x", Path: "/b/w/x"},
+		{Kind: KindGitRepo, Name: "w_x", Path: "/c/w/x"},
+	}
+	var got []string
+	for _, it := range resolveCollisions(context.Background(), items, CollisionDisambiguate) {
+		got = append(got, it.Name)
+	}
+	ax, cx := altSessionName("w_x", "/a/w/x"), altSessionName("w_x", "/c/w/x")
+	if want := []string{"w_x", ax, ax, "w_x", cx}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// ensure, new and -input-file resolve a colliding path the same way.
+	cfg := Config{CollisionStrategy: CollisionDisambiguate}
+	shell = &fakeShell{err: map[string]error{
+		k("tmux", "has-session", "-t", altSessionName("w_x", "/a/w/x")): errors.New("no"),
+		k("tmux", "has-session", "-t", altSessionName("w_x", "/b/w/x")): errors.New("no"),
+	}}
+	if got := sessionNameForDir(context.Background(), cfg, "/a/w/x"); got != ax {
+		t.Errorf("sessionNameForDir(/a/w/x) = %q, want %q", got, ax)
+	}
+	if got := sessionNameForDir(context.Background(), cfg, "/b/w/x"); got != "w_x" {
+		t.Errorf("sessionNameForDir(/b/w/x) = %q, want w_x", got)
+	}
+	if got := sessionNameForDir(context.Background(), Config{}, "/a/w/x"); got != "w_x" {
+		t.Errorf("without disambiguate: %q, want w_x", got)
+	}
+	if _, err := parseCollisionStrategy("random"); err == nil {
+		t.Fatal("parseCollisionStrategy accepted random")
+	}
+}
+
+func TestShareSession(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	old := shell
+	defer func() { shell = old }()
+	shell = &fakeShell{avail: map[string]bool{"tmux": true}}
+	if err := runShareSession(Options{}, []string{"api"}); err == nil || !strings.Contains(err.Error(), "tmate") {
+		t.Fatalf("missing tmate: %v", err)
+	}
+
+	sock := tmateSocket("api")
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "display-message", "-t", "api", "-p", "#{session_path}"):    []byte("/code/api\n"),
+		k("tmate", "-S", sock, "display", "-p", "#{tmate_ssh}\t#{tmate_web}"): []byte("ssh rw@lon1.tmate.io\thttps://tmate.io/t/rw\n"),
+	}}
+	shell = f
+	if err := runShareSession(Options{}, []string{"-read-write", "api"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := k("tmate", "-S", sock, "new-session", "-d", "-c", "/code/api"); !slices.Contains(f.calls, want) {
+		t.Fatalf("calls %q lack %q", f.calls, want)
+	}
+	ssh, web, err := tmateLinks(context.Background(), sock, true)
+	if err != nil || ssh != "ssh rw@lon1.tmate.io" || web != "https://tmate.io/t/rw" {
+		t.Fatalf("tmateLinks = %q, %q, %v", ssh, web, err)
+	}
+	if _, _, err := tmateLinks(context.Background(), sock, false); err == nil {
+		t.Fatal("read-only link without tmate output")
+	}
+}
+
+func TestDryRunShell(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	inner := &fakeShell{
+		out: map[string][]byte{k("tmux", "list-sessions", "-F", "#S"): []byte("api\n")},
+		err: map[string]error{k("tmux", "has-session", "-t", "web"): errors.New("no session")},
+	}
+	var buf bytes.Buffer
+	d := dryRunShell{inner: inner, w: &buf}
+	ctx := context.Background()
+	old := shell
+	defer func() { shell = old }()
+	shell = d
+
+	if out, _ := d.Output(ctx, "tmux", "list-sessions", "-F", "#S"); string(out) != "api\n" {
+		t.Fatalf("Output not passed through: %q", out)
+	}
+	_, created, err := createSessionForDir(ctx, Config{WindowLayout: "main-vertical"}, "web", "/code/my web")
+	if err != nil || !created {
+		t.Fatalf("createSessionForDir = %t, %v", created, err)
+	}
+	want := "+ tmux new-session -ds web -c '/code/my web'\n+ tmux select-layout -t web main-vertical\n"
+	if buf.String() != want {
+		t.Fatalf("printed %q, want %q", buf.String(), want)
+	}
+	for _, c := range inner.calls {
+		if strings.Contains(c, "new-session") || strings.Contains(c, "select-layout") {
+			t.Fatalf("dry run executed %q", c)
+		}
+	}
+}
+
+func TestCheckStaleSessions(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	live := t.TempDir()
+	gone := filepath.Join(t.TempDir(), "removed")
+	if err := saveLinks(Links{"linked": gone}); err != nil {
+		t.Fatal(err)
+	}
+	old := shell
+	defer func() { shell = old }()
+	path := "#{pane_current_path}"
+	f := &fakeShell{out: map[string][]byte{
+		k("tmux", "list-sessions", "-F", "#S"):                 []byte("linked\nok\npane\n"),
+		k("tmux", "display-message", "-t", "ok", "-p", path):   []byte(live + "\n"),
+		k("tmux", "display-message", "-t", "pane", "-p", path): []byte(gone + " (deleted)\n"),
+	}}
+	shell = f
+
+	links, _ := loadLinks()
+	got := staleSessions(context.Background(), []string{"linked", "ok", "pane"}, links)
+	want := []staleSession{{"linked", gone}, {"pane", gone}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("stale = %v, want %v", got, want)
+	}
+	if err := runCheckStaleSessions(Options{}, []string{"-kill-stale"}); err != nil {
+		t.Fatal(err)
+	}
+	var killed []string
+	for _, c := range f.calls {
+		if s, ok := strings.CutPrefix(c, k("tmux", "kill-session", "-t")+" "); ok {
+			killed = append(killed, s)
+		}
+	}
+	if !slices.Equal(killed, []string{"linked", "pane"}) {
+		t.Fatalf("killed %q", killed)
+	}
+}
+
+func TestProjectConfig(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	trust := func(dir string) {
+		t.Helper()
+		captureStdout(t, func() {
+			if err := runTrust(Options{}, []string{dir}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	dir := filepath.Join(t.TempDir(), "org", "api")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		WindowLayout:      "tiled",
+		Hooks:             Hooks{PreCreate: []string{"global-pre"}, PostCreate: []string{"global-post"}},
+		Layouts:           map[string]string{"*": "global"},
+		LayoutDefinitions: map[string][]LayoutWindow{"global": {{Name: "g"}}},
+	}
+
+	got, sess, err := applyProjectConfig(cfg, "org_api", dir)
+	if err != nil || sess != "org_api" || !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("without a project file: %+v, %q, %v", got, sess, err)
+	}
+
+	project := `
+name_template: "{{.Base}}-dev"
+hooks:
+  pre_create: ["make deps"]
+layout:
+  - name: server
+    cmd: make run
+`
+	if err := os.WriteFile(filepath.Join(dir, projectFileName), []byte(project), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, sess, err = applyProjectConfig(cfg, "org_api", dir)
+	if err != nil || sess != "org_api" || !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("an untrusted project file was applied: %+v, %q, %v", got, sess, err)
+	}
+	trust(dir)
+	got, sess, err = applyProjectConfig(cfg, "org_api", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess != "api-dev" {
+		t.Errorf("session %q, want api-dev", sess)
+	}
+	if got.WindowLayout != "tiled" {
+		t.Errorf("window_layout %q, want the global one", got.WindowLayout)
+	}
+	if want := (Hooks{PreCreate: []string{"make deps"}, PostCreate: []string{"global-post"}}); !reflect.DeepEqual(got.Hooks, want) {
+		t.Errorf("hooks %+v, want %+v", got.Hooks, want)
+	}
+	if wins, _ := layoutFor(got, dir); !reflect.DeepEqual(wins, []LayoutWindow{{Name: "server", Cmd: "make run"}}) {
+		t.Errorf("layout %+v", wins)
+	}
+
+	// Every session tsm creates for dir gets the project file.
+	old := shell
+	defer func() { shell = old }()
+	f := &fakeShell{err: map[string]error{k("tmux", "has-session", "-t", "api-dev"): errors.New("no")}}
+	shell = f
+	name, created, err := createSessionForDir(context.Background(), Config{}, "org_api", dir)
+	if err != nil || !created || name != "api-dev" || !slices.Contains(f.calls, k("tmux", "new-session", "-ds", "api-dev", "-c", dir)) {
+		t.Fatalf("createSessionForDir: %q, %v, %v; calls %q", name, created, err, f.calls)
+	}
+
+	// Editing the file withdraws the approval.
+	if err := os.WriteFile(filepath.Join(dir, projectFileName), []byte("layout: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err = applyProjectConfig(cfg, "org_api", dir); err != nil || !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("an edited project file was applied: %+v, %v", got, err)
+	}
+	trust(dir)
+	if got, _, err = applyProjectConfig(cfg, "org_api", dir); err != nil {
+		t.Fatal(err)
+	}
+	if wins, _ := layoutFor(got, dir); len(wins) != 0 {
+		t.Errorf("an empty project layout still opened %+v", wins)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, projectFileName), []byte("name_template: \"{{.Nope}}\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	trust(dir)
+	if _, _, err := applyProjectConfig(cfg, "org_api", dir); err == nil {
+		t.Fatal("bad name_template accepted")
+	}
+
+	captureStdout(t, func() {
+		if err := runTrust(Options{}, []string{"-remove", dir}); err != nil {
+			t.Error(err)
+		}
+	})
+	if trusted, _ := loadTrusted(); len(trusted) != 0 {
+		t.Fatalf("trust -remove left %v", trusted)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// ---------------- generate-makefile ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:        "generate-makefile",
+		Summary:     "Write Makefile.tsm with targets for a session: generate-makefile [-append] <session>",
+		Run:         runGenerateMakefile,
+		SessionArgs: true,
+	})
+}
+
+// makefileTemplate renders the targets; recipes must start with a tab.
+var makefileTemplate = template.Must(template.New("makefile").Parse(`
+# tsm targets for session {{.Session}}, written by ` + "`tsm generate-makefile`" + `.
+TSM ?= tsm
+TSM_SESSION ?= {{.Session}}
+TSM_DIR ?= {{.Dir}}
+
+.PHONY: open kill watch path
+
+open: ## create the session if needed and switch to it
+	$(TSM) new -name '$(TSM_SESSION)' '$(TSM_DIR)'
+
+kill: ## kill the session
+	tmux kill-session -t '$(TSM_SESSION)'
+
+watch: ## attach read-only
+	$(TSM) watch-session '$(TSM_SESSION)'
+
+path: ## print the session directory
+	@echo '$(TSM_DIR)'
+` + makefileEnd + `
+`))
+
+const (
+	makefileStart = "# tsm targets for session "
+	makefileEnd   = "# end of tsm targets"
+)
+
+// makefileTargets are the targets makefileTemplate defines.
+var makefileTargets = []string{"open", "kill", "watch", "path"}
+
+// mergeMakefile returns existing with block in place of the tsm targets it
+// already has, or appended when it has none. It fails when existing defines
+// one of makefileTargets itself, since make would run only one recipe.
+func mergeMakefile(existing, block string) (string, error) {
+	if start := strings.Index(existing, "\n"+makefileStart); start >= 0 {
+		if end := strings.Index(existing[start:], "\n"+makefileEnd+"\n"); end >= 0 {
+			end += start + len(makefileEnd) + 2
+			return existing[:start] + block + existing[end:], nil
+		}
+	}
+	for line := range strings.Lines(existing) {
+		for _, t := range makefileTargets {
+			if strings.HasPrefix(line, t+":") {
+				return "", fmt.Errorf("a %s target already exists; omit -append to write Makefile.tsm", t)
+			}
+		}
+	}
+	return existing + block, nil
+}
+
+// writeMakefile renders the targets for sess in dir to w.
+func writeMakefile(w io.Writer, sess, dir string) error {
+	return makefileTemplate.Execute(w, struct{ Session, Dir string }{sess, dir})
+}
+
+// sessionDir returns the directory of sess: its link, else its tmux
+// session_path.
+func sessionDir(ctx context.Context, sess string) (string, error) {
+	if links, err := loadLinks(); err == nil && links[sess] != "" {
+		return links[sess], nil
+	}
+	out, err := shell.Output(ctx, "tmux", "display-message", "-t", sess, "-p", "#{session_path}")
+	if err != nil {
+		return "", err
+	}
+	dir := strings.TrimSpace(string(out))
+	if dir == "" {
+		return "", fmt.Errorf("%s has no known directory", sess)
+	}
+	return dir, nil
+}
+
+func runGenerateMakefile(opts Options, args []string) error {
+	fs := flag.NewFlagSet("generate-makefile", flag.ContinueOnError)
+	appendTo := fs.Bool("append", false, "Append the targets to ./Makefile instead of writing ./Makefile.tsm")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tsm generate-makefile [-append] <session>")
+	}
+	sess := fs.Arg(0)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	dir, err := sessionDir(ctx, sess)
+	if err != nil {
+		return err
+	}
+
+	var block strings.Builder
+	if err := writeMakefile(&block, sess, dir); err != nil {
+		return err
+	}
+	path, data := "Makefile.tsm", block.String()
+	if *appendTo {
+		path = "Makefile"
+		existing, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if data, err = mergeMakefile(string(existing), data); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s targets → %s\n", sess, path)
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ---------------- move-session ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:        "move-session",
+		Summary:     "Recreate a session on another tmux server: move-session -socket NAME [-keep] [-yes] <session>",
+		Run:         runMoveSession,
+		SessionArgs: true,
+	})
+}
+
+// sessionSnapshot is the shape of a session: its windows in order with
+// their layouts and the working directory of each pane.
+type sessionSnapshot struct {
+	Name    string
+	Windows []windowSnapshot
+}
+
+type windowSnapshot struct {
+	Name   string
+	Layout string
+	Dirs   []string // one per pane, in pane order
+}
+
+// snapshotSession records the windows and pane directories of sess.
+func snapshotSession(ctx context.Context, sess string) (sessionSnapshot, error) {
+	snap := sessionSnapshot{Name: sess}
+	out, err := shell.Output(ctx, "tmux", "list-windows", "-t", sess, "-F", "#{window_index}\t#{window_name}\t#{window_layout}")
+	if err != nil {
+		return snap, err
+	}
+	byIndex := map[string]int{}
+	for line := range strings.Lines(string(out)) {
+		f := strings.SplitN(strings.TrimRight(line, "\n"), "\t", 3)
+		if len(f) != 3 {
+			continue
+		}
+		byIndex[f[0]] = len(snap.Windows)
+		snap.Windows = append(snap.Windows, windowSnapshot{Name: f[1], Layout: f[2]})
+	}
+	out, err = shell.Output(ctx, "tmux", "list-panes", "-s", "-t", sess, "-F", "#{window_index}\t#{pane_current_path}")
+	if err != nil {
+		return snap, err
+	}
+	for line := range strings.Lines(string(out)) {
+		win, dir, ok := strings.Cut(strings.TrimRight(line, "\n"), "\t")
+		if i, known := byIndex[win]; ok && known {
+			snap.Windows[i].Dirs = append(snap.Windows[i].Dirs, dir)
+		}
+	}
+	snap.Windows = slices.DeleteFunc(snap.Windows, func(w windowSnapshot) bool { return len(w.Dirs) == 0 })
+	if len(snap.Windows) == 0 {
+		return snap, fmt.Errorf("%s: no windows to move", sess)
+	}
+	return snap, nil
+}
+
+// restore recreates the snapshot on the tmux server selected by server
+// (e.g. "-L", "work"). Commands running in the panes are not carried over.
+func (s sessionSnapshot) restore(ctx context.Context, server []string) error {
+	tmux := func(args ...string) error {
+		return shell.Run(ctx, "tmux", slices.Concat(server, args)...)
+	}
+	for i, w := range s.Windows {
+		var err error
+		if i == 0 {
+			err = tmux("new-session", "-ds", s.Name, "-c", w.Dirs[0], "-n", w.Name)
+		} else {
+			err = tmux("new-window", "-t", s.Name, "-c", w.Dirs[0], "-n", w.Name)
+		}
+		for _, dir := range w.Dirs[1:] {
+			if err == nil {
+				err = tmux("split-window", "-t", s.Name, "-c", dir)
+			}
+		}
+		if err == nil && len(w.Dirs) > 1 {
+			err = tmux("select-layout", "-t", s.Name, w.Layout)
+		}
+		if err != nil {
+			return fmt.Errorf("window %d (%s): %w", i, w.Name, err)
+		}
+	}
+	return tmux("select-window", "-t", s.Name+":^")
+}
+
+func runMoveSession(opts Options, args []string) error {
+	fs := flag.NewFlagSet("move-session", flag.ContinueOnError)
+	socket := fs.String("socket", "", "Socket name (tmux -L) of the target server")
+	keep := fs.Bool("keep", false, "Keep the session on the current server")
+	yes := fs.Bool("yes", false, "Kill the original session without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *socket == "" {
+		return errors.New("usage: tsm move-session -socket NAME [-keep] [-yes] <session>")
+	}
+	sess := fs.Arg(0)
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+	server := []string{"-L", *socket}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	if _, err := shell.Output(ctx, "tmux", slices.Concat(server, []string{"list-sessions", "-F", "#S"})...); err != nil {
+		return fmt.Errorf("target server %q is not running: %w", *socket, err)
+	}
+	if shell.Run(ctx, "tmux", slices.Concat(server, []string{"has-session", "-t", sess})...) == nil {
+		return fmt.Errorf("%w on %q: %s", ErrSessionExists, *socket, sess)
+	}
+	snap, err := snapshotSession(ctx, sess)
+	if err != nil {
+		return err
+	}
+	if err := snap.restore(ctx, server); err != nil {
+		return fmt.Errorf("restore on %q: %w", *socket, err)
+	}
+	panes := 0
+	for _, w := range snap.Windows {
+		panes += len(w.Dirs)
+	}
+	fmt.Printf("%s -> %s (%d windows, %d panes)\n", sess, *socket, len(snap.Windows), panes)
+	fmt.Println("Programs running in the panes were not moved.")
+	if *keep || !*yes && !confirm(fmt.Sprintf("Kill %s on the current server?", sess)) {
+		return nil
+	}
+	// The timeout starts after the prompt, which may wait on the user.
+	kctx, kcancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer kcancel()
+	return killSession(kctx, sess)
+}
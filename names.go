@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/template"
+)
+
+// ---------------- Session name templates ----------------
+
+// NameTemplateData is the value a session name template is executed with.
+type NameTemplateData struct {
+	Root   string // scan path the directory was found under ("" if none)
+	Parent string // closest ancestor with a usable name
+	Base   string // the directory itself
+	Depth  int    // directories between Root (or "/") and the directory
+}
+
+func parseNameTemplate(text string) (*template.Template, error) {
+	return template.New("name").Option("missingkey=error").Parse(text)
+}
+
+// nameTemplate is a parsed name_template with the scan paths .Root is
+// resolved against.
+type nameTemplate struct {
+	tmpl  *template.Template
+	roots []string
+}
+
+// activeNameTemplate caches the config's name_template; nil means the
+// default naming.
+var activeNameTemplate atomic.Pointer[nameTemplate]
+
+// useNameTemplate parses cfg.NameTemplate and makes sessionNameFromPath use
+// it. An empty template restores the default naming.
+func useNameTemplate(cfg Config) error {
+	if cfg.NameTemplate == "" {
+		activeNameTemplate.Store(nil)
+		return nil
+	}
+	t, err := parseNameTemplate(cfg.NameTemplate)
+	if err != nil {
+		return err
+	}
+	activeNameTemplate.Store(&nameTemplate{tmpl: t, roots: cfg.ScanPaths})
+	return nil
+}
+
+// sessionNameMaxLen is the config's session_name_max_len; 0 means names
+// are not truncated.
+var sessionNameMaxLen atomic.Int64
+
+// truncSuffix marks a shortened session name. It must not be "." or ":":
+// tmux rewrites those in session names and reads them as target separators.
+const truncSuffix = "_"
+
+// useSessionNameMaxLen makes sessionNameFromPath shorten names to
+// cfg.SessionNameMaxLen characters.
+func useSessionNameMaxLen(cfg Config) error {
+	if n := cfg.SessionNameMaxLen; n != 0 && n <= len(truncSuffix) {
+		return fmt.Errorf("%d leaves no room for the name (want 0 or more than %d)", n, len(truncSuffix))
+	}
+	sessionNameMaxLen.Store(int64(cfg.SessionNameMaxLen))
+	return nil
+}
+
+// truncateSessionName shortens name to limit characters ending in truncSuffix,
+// dropping separators left dangling before the suffix.
+func truncateSessionName(name string, limit int) string {
+	if limit <= 0 || len(name) <= limit {
+		return name // sanitized names are ASCII, so bytes are characters
+	}
+	head := strings.TrimRight(name[:limit-len(truncSuffix)], "-_./")
+	return head + truncSuffix
+}
+
+// nameTemplateData describes dir relative to the first of roots containing it.
+func nameTemplateData(dir string, roots []string) NameTemplateData {
+	data := NameTemplateData{
+		Parent: nearestParentName(dir),
+		Base:   sanitize(filepath.Base(dir)),
+	}
+	rel := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(dir)), "/")
+	for _, r := range roots {
+		root, ok := expandPath(r)
+		if !ok {
+			continue
+		}
+		if p, err := filepath.Rel(root, dir); err == nil && p != ".." && !strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			data.Root = sanitizeRaw(filepath.Base(root))
+			rel = filepath.ToSlash(p)
+			break
+		}
+	}
+	if rel != "." && rel != "" {
+		data.Depth = strings.Count(rel, "/") + 1
+	}
+	return data
+}
+
+// renderSessionName executes t and sanitizes each "/"-separated segment of
+// the result so the name is safe to pass to tmux.
+func renderSessionName(t *template.Template, data NameTemplateData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	var parts []string
+	for seg := range strings.SplitSeq(b.String(), "/") {
+		if s := sanitizeRaw(seg); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("template %q produced an empty name", t.Root.String())
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "format-name",
+		Summary: "Print the session name tsm would use for a path: format-name [-name-template T] <path>",
+		Run:     runFormatName,
+	})
+}
+
+func runFormatName(opts Options, args []string) error {
+	fs := flag.NewFlagSet("format-name", flag.ContinueOnError)
+	tmpl := fs.String("name-template", "", "Go template to try, e.g. '{{.Parent}}_{{.Base}}'")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tsm format-name [-name-template T] <path>")
+	}
+	dir, ok := expandPath(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("cannot expand %s", fs.Arg(0))
+	}
+	cfg, err := loadRunConfig(opts) // applies the configured name_template
+	if err != nil {
+		return err
+	}
+	if *tmpl == "" {
+		fmt.Println(sessionNameFromPath(dir))
+		return nil
+	}
+	t, err := parseNameTemplate(*tmpl)
+	if err != nil {
+		return err
+	}
+	name, err := renderSessionName(t, nameTemplateData(dir, cfg.ScanPaths))
+	if err != nil {
+		return err
+	}
+	fmt.Println(name)
+	return nil
+}
+
+// CollisionStrategy decides what happens when directories at different
+// paths derive the same session name.
+type CollisionStrategy string
+
+const (
+	CollisionFirst        CollisionStrategy = "first"        // list every path, silently
+	CollisionWarn         CollisionStrategy = "warn"         // list every path, log the collisions
+	CollisionDisambiguate CollisionStrategy = "disambiguate" // give all but one path a path-derived name
+)
+
+func parseCollisionStrategy(s string) (CollisionStrategy, error) {
+	switch c := CollisionStrategy(s); c {
+	case "":
+		return CollisionFirst, nil
+	case CollisionFirst, CollisionWarn, CollisionDisambiguate:
+		return c, nil
+	}
+	return "", fmt.Errorf("invalid collision_strategy %q (want first, warn or disambiguate)", s)
+}
+
+// altSessionName is the disambiguated name for dir: name plus a short hash
+// of the path, so it is the same wherever tsm derives it.
+func altSessionName(name, dir string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(filepath.Clean(dir)))
+	return fmt.Sprintf("%s-%04x", name, h.Sum32()&0xffff)
+}
+
+// disambiguatedName returns the session name for dir under
+// CollisionDisambiguate: altSessionName when that session exists or when
+// the session called name belongs to another directory, else name.
+func disambiguatedName(ctx context.Context, name, dir string, exists func(string) bool) string {
+	alt := altSessionName(name, dir)
+	if exists(alt) {
+		return alt
+	}
+	if exists(name) {
+		if d, err := sessionDir(ctx, name); err == nil && filepath.Clean(d) != filepath.Clean(dir) {
+			return alt
+		}
+	}
+	return name
+}
+
+// sessionNameForDir names the session for dir as the picker lists it, so
+// ensure, new and -input-file open the same session for a colliding path.
+func sessionNameForDir(ctx context.Context, cfg Config, dir string) string {
+	name := sessionNameFromPath(dir)
+	if cfg.CollisionStrategy != CollisionDisambiguate {
+		return name
+	}
+	return disambiguatedName(ctx, name, dir, func(s string) bool { return hasSession(ctx, s) })
+}
+
+// resolveCollisions applies strategy to directory items whose name is also
+// derived by an item with another path. Sessions are left alone: they are
+// what a colliding name would switch to.
+func resolveCollisions(ctx context.Context, items []Item, strategy CollisionStrategy) []Item {
+	if strategy != CollisionWarn && strategy != CollisionDisambiguate {
+		return items
+	}
+	sessions := map[string]bool{}
+	paths := map[string][]string{} // session name → distinct directories
+	for _, it := range items {
+		switch {
+		case it.Kind == KindSession:
+			sessions[it.Name] = true
+		case it.Path != "" && !slices.Contains(paths[it.Name], it.Path):
+			paths[it.Name] = append(paths[it.Name], it.Path)
+		}
+	}
+	owner := map[string]string{} // plain name → the directory keeping it
+	for i, it := range items {
+		if it.Kind == KindSession || len(paths[it.Name]) < 2 {
+			continue
+		}
+		if strategy == CollisionWarn {
+			if first := paths[it.Name][0]; first != it.Path {
+				slog.Warn("session name collision", "name", it.Name, "path", it.Path, "other", first)
+			}
+			continue
+		}
+		name := disambiguatedName(ctx, it.Name, it.Path, func(s string) bool { return sessions[s] })
+		if name == it.Name {
+			if o, ok := owner[name]; ok && o != it.Path {
+				name = altSessionName(it.Name, it.Path)
+			} else {
+				owner[name] = it.Path
+			}
+		}
+		items[i].Name = name
+	}
+	return items
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"runtime"
+	"strings"
+)
+
+// ---------------- open-url ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:        "open-url",
+		Summary:     "Open a repo's git remote in the browser: open-url [-remote origin] [name]",
+		Run:         runOpenURL,
+		SessionArgs: true,
+	})
+}
+
+// remoteWebURL turns a git remote URL into the https URL of its web page:
+// git@github.com:org/repo.git and ssh://git@github.com/org/repo both become
+// https://github.com/org/repo.
+func remoteWebURL(remote string) (string, error) {
+	remote = strings.TrimSpace(remote)
+	if !strings.Contains(remote, "://") {
+		// scp-like syntax: [user@]host:path
+		host, path, ok := strings.Cut(remote, ":")
+		if !ok || path == "" || strings.Contains(host, "/") {
+			return "", fmt.Errorf("remote %q is not a URL", remote)
+		}
+		if _, h, ok := strings.Cut(host, "@"); ok {
+			host = h
+		}
+		remote = "ssh://" + host + "/" + strings.TrimPrefix(path, "/")
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "ssh", "git", "git+ssh", "ssh+git":
+		u.Scheme = "https"
+		u.Host = u.Hostname() // an ssh port is not the web port
+	default:
+		return "", fmt.Errorf("remote %q has no web URL", remote)
+	}
+	u.User = nil
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	return u.String(), nil
+}
+
+// browserCommand returns the command line that opens target in the
+// default browser.
+func browserCommand(target string) (string, []string) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "open", []string{target}
+	case "windows":
+		return "cmd", []string{"/C", "start", "", target}
+	}
+	return "xdg-open", []string{target}
+}
+
+// openRemoteURL opens the web page of it's git remote in the browser.
+func openRemoteURL(ctx context.Context, cfg Config, it Item, remote string) error {
+	if err := requireGit(cfg, "open-url"); err != nil {
+		return err
+	}
+	if it.Path == "" {
+		return fmt.Errorf("%s has no known path (link it with `tsm link`)", it.Name)
+	}
+	out, err := shell.Output(ctx, "git", "-C", it.Path, "remote", "get-url", remote)
+	if err != nil {
+		return fmt.Errorf("%s: no remote %q: %w", it.Name, remote, err)
+	}
+	target, err := remoteWebURL(string(out))
+	if err != nil {
+		return err
+	}
+	name, args := browserCommand(target)
+	if err := shell.Run(ctx, name, args...); err != nil {
+		return err
+	}
+	fmt.Printf("Opened %s\n", target)
+	return nil
+}
+
+// runOpenURL opens the named item's remote, or opens the picker when no
+// name is given.
+func runOpenURL(opts Options, args []string) error {
+	fs := flag.NewFlagSet("open-url", flag.ContinueOnError)
+	remote := fs.String("remote", "origin", "Git remote whose URL is opened")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || *remote == "" {
+		return errors.New("usage: tsm open-url [-remote origin] [name]")
+	}
+	if fs.NArg() == 0 {
+		opts.OpenRemote = *remote
+		return Run(opts)
+	}
+
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := cfg.matchOptions()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	it, ok := findItem(buildItems(ctx, cfg), fs.Arg(0), false, m)
+	if !ok {
+		return fmt.Errorf("no item matches %q", fs.Arg(0))
+	}
+	return openRemoteURL(ctx, cfg, it, *remote)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// ---------------- Project files ----------------
+
+// ProjectConfig is the part of Config a project's .tsm.yaml may set for
+// the sessions tsm creates in that directory.
+type ProjectConfig struct {
+	NameTemplate string `mapstructure:"name_template"`
+	Hooks        Hooks  `mapstructure:"hooks"`
+	// Layout lists the windows opened after the first one, replacing any
+	// layouts match; an empty list opens none.
+	Layout []LayoutWindow `mapstructure:"layout"`
+}
+
+// projectSettings returns the global values of the ProjectConfig keys, the
+// base a project file is merged over.
+func projectSettings(cfg Config) map[string]any {
+	return map[string]any{
+		"name_template": cfg.NameTemplate,
+		"hooks": map[string]any{
+			"pre_create":  cfg.Hooks.PreCreate,
+			"post_create": cfg.Hooks.PostCreate,
+		},
+	}
+}
+
+// applyProjectConfig merges the project file in dir, if any, over cfg and
+// returns the config and session name to create sess with. Maps merge key
+// by key, so a file setting only hooks.pre_create keeps the global
+// post_create hooks. A name_template in the file renames the session.
+// A file `tsm trust` has not approved, as it is now, is ignored: its hooks
+// run commands, and it comes with whatever was cloned.
+func applyProjectConfig(cfg Config, sess, dir string) (Config, string, error) {
+	if _, ok := sshHost(dir); ok {
+		return cfg, sess, nil
+	}
+	path := filepath.Join(dir, projectFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, sess, nil
+	} else if err != nil {
+		return cfg, sess, err
+	}
+	if trusted, _ := loadTrusted(); trusted[dir] != projectFileHash(data) {
+		slog.Warn("ignoring untrusted project file", "path", path, "hint", "review it, then run `tsm trust "+shellQuote(dir)+"`")
+		return cfg, sess, nil
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return cfg, sess, fmt.Errorf("parse %s: %w", path, err)
+	}
+	pv := viper.New()
+	if err := pv.MergeConfigMap(m); err != nil {
+		return cfg, sess, fmt.Errorf("%s: %w", path, err)
+	}
+
+	v := viper.New()
+	if err := v.MergeConfigMap(projectSettings(cfg)); err != nil {
+		return cfg, sess, err
+	}
+	if err := v.MergeConfigMap(pv.AllSettings()); err != nil {
+		return cfg, sess, fmt.Errorf("%s: %w", path, err)
+	}
+	var pc ProjectConfig
+	if err := v.Unmarshal(&pc); err != nil {
+		return cfg, sess, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg.Hooks = pc.Hooks
+	if pv.IsSet("layout") {
+		cfg.ProjectLayout = pc.Layout
+		if cfg.ProjectLayout == nil {
+			cfg.ProjectLayout = []LayoutWindow{}
+		}
+	}
+	if pv.IsSet("name_template") {
+		cfg.NameTemplate = pc.NameTemplate
+		name, err := projectSessionName(pc.NameTemplate, dir, cfg.ScanPaths)
+		if err != nil {
+			return cfg, sess, fmt.Errorf("%s: name_template: %w", path, err)
+		}
+		sess = name
+	}
+	return cfg, sess, nil
+}
+
+// projectSessionName names the session for dir with text, a name_template
+// from a project file; an empty text means the default naming.
+func projectSessionName(text, dir string, roots []string) (string, error) {
+	limit := int(sessionNameMaxLen.Load())
+	if text == "" {
+		return truncateSessionName(defaultSessionName(dir), limit), nil
+	}
+	t, err := parseNameTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	name, err := renderSessionName(t, nameTemplateData(dir, roots))
+	if err != nil {
+		return "", err
+	}
+	return truncateSessionName(name, limit), nil
+}
+
+// ---------------- trust ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:    "trust",
+		Summary: "Let the " + projectFileName + " in a directory configure its sessions: trust [-remove] [dir]",
+		Run:     runTrust,
+	})
+}
+
+// Trusted maps a directory to the SHA-256 of the project file `tsm trust`
+// approved there; editing the file revokes the approval.
+type Trusted map[string]string
+
+func trustedPath() (string, error) {
+	dir, err := xdgDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trusted.yaml"), nil
+}
+
+// loadTrusted reads trusted.yaml; a missing file yields an empty set.
+func loadTrusted() (Trusted, error) {
+	path, err := trustedPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Trusted{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	trusted := Trusted{}
+	if err := yaml.Unmarshal(data, &trusted); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return trusted, nil
+}
+
+func saveTrusted(trusted Trusted) error {
+	path, err := trustedPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(trusted)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func projectFileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func runTrust(_ Options, args []string) error {
+	fs := flag.NewFlagSet("trust", flag.ContinueOnError)
+	remove := fs.Bool("remove", false, "Withdraw the approval instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: tsm trust [-remove] [dir]")
+	}
+	arg := "."
+	if fs.NArg() == 1 {
+		arg = fs.Arg(0)
+	}
+	dir, ok := expandPath(arg)
+	if !ok {
+		return fmt.Errorf("cannot resolve path %q", arg)
+	}
+	trusted, err := loadTrusted()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, projectFileName)
+	if *remove {
+		delete(trusted, dir)
+		if err := saveTrusted(trusted); err != nil {
+			return err
+		}
+		fmt.Printf("Untrusted %s\n", path)
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	trusted[dir] = projectFileHash(data)
+	if err := saveTrusted(trusted); err != nil {
+		return err
+	}
+	fmt.Printf("Trusted %s\n", path)
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ---------------- import-projectile ----------------
+
+// projectileFiles are the usual locations of Projectile's known-projects
+// file, relative to $HOME.
+var projectileFiles = []string{
+	".emacs.d/.cache/projectile-bookmarks.eld",
+	".emacs.d/projectile-bookmarks.eld",
+	".config/emacs/.cache/projectile-bookmarks.eld",
+	".config/emacs/projectile-bookmarks.eld",
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "import-projectile",
+		Summary: "Add Emacs Projectile's known projects to the config: import-projectile [-file F] [-to bookmarks|scan_paths]",
+		Run:     runImportProjectile,
+	})
+}
+
+// parseProjectileBookmarks extracts the string literals of an Emacs Lisp
+// list such as ("~/src/a/" "~/src/b/").
+func parseProjectileBookmarks(data string) []string {
+	var res []string
+	for {
+		start := strings.IndexByte(data, '"')
+		if start < 0 {
+			return res
+		}
+		var b strings.Builder
+		i := start + 1
+		for ; i < len(data) && data[i] != '"'; i++ {
+			if data[i] == '\\' && i+1 < len(data) {
+				i++
+			}
+			b.WriteByte(data[i])
+		}
+		if i >= len(data) { // unterminated string
+			return res
+		}
+		res = append(res, b.String())
+		data = data[i+1:]
+	}
+}
+
+func findProjectileFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	for _, rel := range projectileFiles {
+		p := filepath.Join(home, rel)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("no projectile-bookmarks.eld found; pass -file")
+}
+
+// newProjectPaths returns the existing directories among candidates that
+// are not already in have, comparing expanded paths.
+func newProjectPaths(candidates, have []string) []string {
+	seen := map[string]bool{}
+	for _, h := range have {
+		if p, ok := expandPath(h); ok {
+			seen[p] = true
+		}
+	}
+	var res []string
+	for _, c := range candidates {
+		c = strings.TrimSuffix(c, "/")
+		p, ok := expandPath(c)
+		if !ok || seen[p] || !isDir(p) {
+			continue
+		}
+		seen[p] = true
+		res = append(res, c)
+	}
+	return res
+}
+
+func runImportProjectile(opts Options, args []string) error {
+	fs := flag.NewFlagSet("import-projectile", flag.ContinueOnError)
+	file := fs.String("file", "", "Projectile bookmarks file (default: look under ~/.emacs.d and ~/.config/emacs)")
+	to := fs.String("to", "bookmarks", "Config list to add the projects to: bookmarks or scan_paths")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to != "bookmarks" && *to != "scan_paths" {
+		return fmt.Errorf("invalid -to %q (want bookmarks or scan_paths)", *to)
+	}
+	src := *file
+	if src == "" {
+		var err error
+		if src, err = findProjectileFile(); err != nil {
+			return err
+		}
+	}
+	eld, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	found := parseProjectileBookmarks(string(eld))
+
+	path := resolveConfigFile(opts.ConfigPath)
+	if path == "" {
+		return ErrConfigNotFound
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("only YAML configs can be updated: %s", path)
+	}
+	cfg, err := loadConfig(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	have := cfg.Bookmarks
+	if *to == "scan_paths" {
+		have = cfg.ScanPaths
+	}
+	added := newProjectPaths(found, have)
+	fmt.Printf("%s: %d projects, %d new existing directories\n", src, len(found), len(added))
+	if len(added) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if doc.Kind == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: config root is not a mapping", path)
+	}
+	if err := appendMappingSequence(doc.Content[0], *to, added); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	out, err := encodeYAML(&doc)
+	if err != nil {
+		return err
+	}
+	if _, err := backupConfig(path, cfg.MaxConfigBackups); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d paths into %s in %s\n", len(added), *to, path)
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyResize is a no-op where SIGWINCH does not exist.
+func notifyResize() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal)
+	return ch, func() { close(ch) }
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ---------------- share-session ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:        "share-session",
+		Summary:     "Start a tmate session in a session's directory and print its link: share-session [-read-write] <session>",
+		Run:         runShareSession,
+		SessionArgs: true,
+	})
+}
+
+// tmateReadyTimeout bounds the wait for tmate to reach its server; the
+// handshake takes longer than a local tmux call.
+const tmateReadyTimeout = 30 * time.Second
+
+const tmateInstallHelp = `share-session needs tmate (https://tmate.io). Install it with:
+  macOS:          brew install tmate
+  Debian/Ubuntu:  sudo apt install tmate
+  Fedora:         sudo dnf install tmate
+  Arch:           sudo pacman -S tmate`
+
+// tmateSocket returns the tmate socket used to share sess.
+func tmateSocket(sess string) string {
+	return filepath.Join(os.TempDir(), "tsm-tmate-"+sanitize(sess)+".sock")
+}
+
+// tmateLinks returns the SSH and web links of the tmate session on sock,
+// read-only unless readWrite is set.
+func tmateLinks(ctx context.Context, sock string, readWrite bool) (ssh, web string, err error) {
+	format := "#{tmate_ssh_ro}\t#{tmate_web_ro}"
+	if readWrite {
+		format = "#{tmate_ssh}\t#{tmate_web}"
+	}
+	out, err := shell.Output(ctx, "tmate", "-S", sock, "display", "-p", format)
+	if err != nil {
+		return "", "", err
+	}
+	ssh, web, _ = strings.Cut(strings.TrimSpace(string(out)), "\t")
+	if ssh == "" {
+		return "", "", errors.New("tmate reported no link")
+	}
+	return ssh, web, nil
+}
+
+func runShareSession(_ Options, args []string) error {
+	fs := flag.NewFlagSet("share-session", flag.ContinueOnError)
+	readWrite := fs.Bool("read-write", false, "Print the read-write link instead of the read-only one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tsm share-session [-read-write] <session>")
+	}
+	if !shell.IsAvailable("tmate") {
+		fmt.Fprintln(os.Stderr, tmateInstallHelp)
+		return errors.New("tmate is not in PATH")
+	}
+	sess := fs.Arg(0)
+	ctx, cancel := context.WithTimeout(context.Background(), tmateReadyTimeout)
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	dir, err := sessionDir(ctx, sess)
+	if err != nil {
+		return err
+	}
+
+	sock := tmateSocket(sess)
+	if err := shell.Run(ctx, "tmate", "-S", sock, "new-session", "-d", "-c", dir); err != nil {
+		return fmt.Errorf("tmate: %w", err)
+	}
+	if err := shell.Run(ctx, "tmate", "-S", sock, "wait", "tmate-ready"); err != nil {
+		return fmt.Errorf("tmate did not become ready: %w", err)
+	}
+	ssh, web, err := tmateLinks(ctx, sock, *readWrite)
+	if err != nil {
+		return err
+	}
+	fmt.Println(ssh)
+	if web != "" {
+		fmt.Println(web)
+	}
+	fmt.Printf("Stop sharing with: tmate -S %s kill-server\n", shellQuote(sock))
+	return nil
+}
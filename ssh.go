@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ---------------- SSH hosts ----------------
+
+// sshScheme prefixes the Path of items that open an SSH connection
+// instead of a directory.
+const sshScheme = "ssh://"
+
+func sshConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// parseSSHHosts returns the Host names in an ssh_config, in order and
+// without duplicates. Patterns (*, ?) and negations (!) are skipped, and
+// Include directives are not followed.
+func parseSSHHosts(r io.Reader) ([]string, error) {
+	var hosts []string
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		// "Host a b", "Host=a" and "host a" are all valid
+		f := strings.FieldsFunc(sc.Text(), func(r rune) bool { return r == ' ' || r == '\t' || r == '=' })
+		if len(f) < 2 || !strings.EqualFold(f[0], "host") {
+			continue
+		}
+		for _, h := range f[1:] {
+			if strings.ContainsAny(h, "*?!") || seen[h] {
+				continue
+			}
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts, sc.Err()
+}
+
+// sshItems lists the hosts of ~/.ssh/config as bookmarks with ssh:// paths.
+func sshItems() []Item {
+	path, err := sshConfigPath()
+	if err != nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+	hosts, err := parseSSHHosts(f)
+	if err != nil {
+		slog.Debug("ssh config not read", "path", path, "err", err)
+	}
+	items := make([]Item, 0, len(hosts))
+	for _, h := range hosts {
+		items = append(items, Item{Kind: KindBookmark, Name: sanitize("ssh_" + h), Path: sshScheme + h})
+	}
+	return items
+}
+
+// sshHost returns the host of an ssh:// item path.
+func sshHost(path string) (string, bool) {
+	host, ok := strings.CutPrefix(path, sshScheme)
+	return host, ok && host != ""
+}
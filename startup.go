@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ---------------- Startup layouts ----------------
+
+// StartupSession is one entry of a -startup-layout file.
+type StartupSession struct {
+	Name    string `yaml:"name"`    // defaults to the name derived from Path
+	Path    string `yaml:"path"`    // working directory; $VARS and ~ are expanded
+	Command string `yaml:"command"` // typed into the first window of a new session
+}
+
+// StartupLayout is the -startup-layout file:
+//
+//	sessions:
+//	  - name: api
+//	    path: ~/Code/api
+//	    command: make dev
+type StartupLayout struct {
+	Sessions []StartupSession `yaml:"sessions"`
+}
+
+// loadStartupLayout reads path, expanding paths and filling in names.
+func loadStartupLayout(path string) (StartupLayout, error) {
+	var l StartupLayout
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l, err
+	}
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return l, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(l.Sessions) == 0 {
+		return l, fmt.Errorf("%s: no sessions defined", path)
+	}
+	for i, s := range l.Sessions {
+		dir, ok := expandPath(s.Path)
+		if s.Path == "" || !ok {
+			return l, fmt.Errorf("%s: session %d: invalid path %q", path, i+1, s.Path)
+		}
+		l.Sessions[i].Path = dir
+		if s.Name == "" {
+			l.Sessions[i].Name = sessionNameFromPath(dir)
+		} else {
+			l.Sessions[i].Name = sanitize(s.Name)
+		}
+	}
+	return l, nil
+}
+
+// startSessions creates every session of l concurrently, recording in
+// l.Sessions the name each one got. Sessions that already exist are left
+// alone; new ones get cfg's create hooks and setup, and their command.
+func startSessions(ctx context.Context, cfg Config, l StartupLayout) error {
+	errs := make([]error, len(l.Sessions))
+	var wg sync.WaitGroup
+	for i, s := range l.Sessions {
+		wg.Go(func() {
+			name, created, err := createSessionForDir(ctx, cfg, s.Name, s.Path)
+			l.Sessions[i].Name = name
+			if err == nil && created && s.Command != "" {
+				// the first window: layout windows were opened after it
+				err = shell.Run(ctx, "tmux", "send-keys", "-t", name+":^", s.Command, "Enter")
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", s.Name, err)
+			}
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// runStartupLayout starts the sessions in file and switches to the first.
+func runStartupLayout(ctx context.Context, cfg Config, file string) error {
+	l, err := loadStartupLayout(file)
+	if err != nil {
+		return err
+	}
+	if err := startSessions(ctx, cfg, l); err != nil {
+		return err
+	}
+	return switchToSession(ctx, cfg, l.Sessions[0].Name, isInTmux())
+}
+
+// ---------------- Input files ----------------
+
+// readInputFile returns the paths in an -input-file: one per line, with
+// blank lines and lines starting with # skipped.
+func readInputFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+// openInputPaths creates a session for every path, writing one status line
+// per path to w. Each path gets its own timeout, so a slow one cannot use
+// up the time of those after it. It returns the sessions that exist
+// afterwards, in order, and the number of paths that failed.
+func openInputPaths(timeout time.Duration, cfg Config, w io.Writer, paths []string) ([]string, int) {
+	var sessions []string
+	failed := 0
+	for _, p := range paths {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		sess, created, err := openInputPath(ctx, cfg, p)
+		cancel()
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(w, "%s: error: %v\n", p, err)
+			continue
+		case created:
+			fmt.Fprintf(w, "%s: created %s\n", p, sess)
+		default:
+			fmt.Fprintf(w, "%s: exists %s\n", p, sess)
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, failed
+}
+
+func openInputPath(ctx context.Context, cfg Config, p string) (string, bool, error) {
+	dir, ok := expandPath(p)
+	if !ok {
+		return "", false, errors.New("cannot expand path")
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return "", false, err
+	} else if !fi.IsDir() {
+		return "", false, errors.New("not a directory")
+	}
+	return createSessionForDir(ctx, cfg, sessionNameForDir(ctx, cfg, dir), dir)
+}
+
+// runInputFile opens a session for every path in file and, unless
+// noAttach is set, switches to the first one. timeout bounds each path
+// and the final switch separately.
+func runInputFile(timeout time.Duration, cfg Config, file string, noAttach bool) error {
+	paths, err := readInputFile(file)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("%s: no paths", file)
+	}
+	sessions, failed := openInputPaths(timeout, cfg, os.Stderr, paths)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d paths failed", failed, len(paths))
+	}
+	if noAttach {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return switchToSession(ctx, cfg, sessions[0], isInTmux())
+}
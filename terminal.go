@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// ---------------- Terminal capabilities ----------------
+
+// TermCapabilities describes what the terminal can render; the picker's
+// render functions consult termCaps instead of assuming a full xterm.
+type TermCapabilities struct {
+	CursorMovement bool // clear the screen and position the cursor with CSI sequences
+	Unicode        bool // glyphs such as ➤ and ↑/↓
+	Colors         int  // 0 (none), 8 (basic ANSI) or 256
+}
+
+// termCaps is set from the environment at startup.
+var termCaps = TermCapabilities{CursorMovement: true, Unicode: true, Colors: 256}
+
+// detectTermCapabilities derives capabilities from $TERM and $TERM_PROGRAM.
+func detectTermCapabilities(term, termProgram string) TermCapabilities {
+	if term == "" || term == "dumb" {
+		return TermCapabilities{}
+	}
+	caps := TermCapabilities{CursorMovement: true, Unicode: true, Colors: 8}
+	if strings.Contains(term, "256color") {
+		caps.Colors = 256
+	}
+	if termProgram == "Apple_Terminal" {
+		caps.Colors = min(caps.Colors, 8)
+	}
+	return caps
+}
+
+// glyph returns fancy when the terminal can show it, else plain.
+func glyph(fancy, plain string) string {
+	if termCaps.Unicode {
+		return fancy
+	}
+	return plain
+}
+
+// ANSI SGR colour codes used for diff-style output.
+const (
+	sgrRed    = "31"
+	sgrGreen  = "32"
+	sgrYellow = "33"
+)
+
+// colorOutput reports whether f should receive ANSI colours: the terminal
+// supports them, $NO_COLOR is unset and f is a character device.
+func colorOutput(f *os.File) bool {
+	if termCaps.Colors == 0 || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// paint wraps s in the SGR code when on is set and code is not empty.
+func paint(s, code string, on bool) string {
+	if !on || code == "" {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ---------------- Colour schemes ----------------
+
+// ThemeColors are the SGR codes the picker paints with; "" leaves that
+// part plain.
+type ThemeColors struct {
+	Header   string // title line
+	Session  string
+	Repo     string // git repos, worktrees and other projects
+	Bookmark string
+	Selected string // added to the highlighted row's kind colour
+}
+
+// themes are the built-in -color-scheme values.
+var themes = map[string]ThemeColors{
+	"dark":  {Header: "1", Session: "96", Repo: "92", Bookmark: "93", Selected: "1;7"},
+	"light": {Header: "1", Session: "34", Repo: "32", Bookmark: "35", Selected: "1;7"},
+	"mono":  {Header: "1", Selected: "1"},
+}
+
+const defaultColorScheme = "dark"
+
+func lookupTheme(name string) (ThemeColors, error) {
+	if name == "" {
+		name = defaultColorScheme
+	}
+	t, ok := themes[name]
+	if !ok {
+		return ThemeColors{}, fmt.Errorf("unknown color scheme %q (want %s)",
+			name, strings.Join(slices.Sorted(maps.Keys(themes)), ", "))
+	}
+	return t, nil
+}
+
+// row returns the SGR code for a list row of kind.
+func (t ThemeColors) row(kind ItemKind, selected bool) string {
+	var code string
+	switch kind {
+	case KindSession:
+		code = t.Session
+	case KindBookmark:
+		code = t.Bookmark
+	default:
+		code = t.Repo
+	}
+	if selected && t.Selected != "" {
+		if code == "" {
+			return t.Selected
+		}
+		return code + ";" + t.Selected
+	}
+	return code
+}
+
+// Theme is the theme config key: per-kind colours layered over the
+// -color-scheme. Each value is an SGR code such as "36" or "1;4", or a
+// colour name such as "cyan" or "bright-green"; "" keeps the scheme's.
+type Theme struct {
+	SessionColor  ColorSpec `mapstructure:"session_color"`
+	RepoColor     ColorSpec `mapstructure:"repo_color"`
+	BookmarkColor ColorSpec `mapstructure:"bookmark_color"`
+	SelectedBG    ColorSpec `mapstructure:"selected_bg"` // a name is a background colour
+}
+
+// ColorSpec is a theme colour as written in the config. A bare SGR code may
+// be unquoted (session_color: 36), so it is a string or an integer there.
+type ColorSpec string
+
+// colorNames are the SGR foreground offsets of the named colours; their
+// background codes are 10 higher.
+var colorNames = map[string]int{
+	"black": 30, "red": 31, "green": 32, "yellow": 33,
+	"blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+	"bright-black": 90, "bright-red": 91, "bright-green": 92, "bright-yellow": 93,
+	"bright-blue": 94, "bright-magenta": 95, "bright-cyan": 96, "bright-white": 97,
+}
+
+var sgrCode = regexp.MustCompile(`^[0-9]+(;[0-9]+)*$`)
+
+// parseColor turns a colour name or SGR code into an SGR code.
+func parseColor(s string, background bool) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, ok := colorNames[s]; ok {
+		if background {
+			n += 10
+		}
+		return strconv.Itoa(n), nil
+	}
+	if !sgrCode.MatchString(s) {
+		return "", fmt.Errorf("invalid colour %q (want an SGR code like \"36\" or one of %s)",
+			s, strings.Join(slices.Sorted(maps.Keys(colorNames)), ", "))
+	}
+	return s, nil
+}
+
+// over returns base with the colours set in t replacing its own.
+func (t Theme) over(base ThemeColors) (ThemeColors, error) {
+	for _, f := range []struct {
+		key string
+		val ColorSpec
+		dst *string
+		bg  bool
+	}{
+		{"session_color", t.SessionColor, &base.Session, false},
+		{"repo_color", t.RepoColor, &base.Repo, false},
+		{"bookmark_color", t.BookmarkColor, &base.Bookmark, false},
+		{"selected_bg", t.SelectedBG, &base.Selected, true},
+	} {
+		if f.val == "" {
+			continue
+		}
+		code, err := parseColor(string(f.val), f.bg)
+		if err != nil {
+			return ThemeColors{}, fmt.Errorf("theme.%s: %w", f.key, err)
+		}
+		*f.dst = code
+	}
+	return base, nil
+}
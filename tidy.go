@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ---------------- tidy ----------------
+
+const projectFileName = ".tsm.yaml"
+
+func init() {
+	registerCommand(Command{
+		Name:    "tidy",
+		Summary: "Remove " + projectFileName + " files from directories tsm no longer discovers",
+		Run:     runTidy,
+	})
+}
+
+// staleProjectFiles walks the scan paths and returns project files whose
+// directory is no longer a discovered repo or a bookmark.
+func staleProjectFiles(cfg Config) []string {
+	known := map[string]bool{}
+	for _, r := range scanGitReposConcurrent(cfg) {
+		known[r] = true
+	}
+	for _, b := range cfg.Bookmarks {
+		if p, ok := expandPath(b); ok {
+			known[p] = true
+		}
+	}
+	excluded := newExcludeSet(cfg.Exclude)
+
+	var stale []string
+	for _, raw := range cfg.ScanPaths {
+		root, ok := expandPath(raw)
+		if !ok {
+			continue
+		}
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && excluded.match(d.Name()) {
+					return fs.SkipDir
+				}
+				if cfg.MaxDepth > 0 && depthFrom(root, path) > cfg.MaxDepth {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.Name() == projectFileName && !known[filepath.Dir(path)] {
+				stale = append(stale, path)
+			}
+			return nil
+		})
+	}
+	slices.Sort(stale)
+	return slices.Compact(stale)
+}
+
+// forgetTrust drops the `tsm trust` records of the removed project files.
+func forgetTrust(removed []string) error {
+	trusted, err := loadTrusted()
+	if err != nil {
+		return err
+	}
+	n := len(trusted)
+	for _, p := range removed {
+		delete(trusted, filepath.Dir(p))
+	}
+	if len(trusted) == n {
+		return nil
+	}
+	return saveTrusted(trusted)
+}
+
+func runTidy(opts Options, args []string) error {
+	fs := flag.NewFlagSet("tidy", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "List stale files without deleting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	stale := staleProjectFiles(cfg)
+	if len(stale) == 0 {
+		fmt.Println("Nothing to tidy.")
+		return nil
+	}
+	for _, p := range stale {
+		fmt.Println(p)
+	}
+	if *dryRun || !confirm(fmt.Sprintf("Remove %d stale %s file(s)?", len(stale), projectFileName)) {
+		return nil
+	}
+	for _, p := range stale {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Removed %d file(s).\n", len(stale))
+	return forgetTrust(stale)
+}
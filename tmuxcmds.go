@@ -0,0 +1,1157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+// ---------------- tmux subcommands ----------------
+
+func init() {
+	registerCommand(Command{
+		Name:        "rename-window",
+		Summary:     "Rename a window: rename-window <session> <old-name|index> <new-name>",
+		Run:         runRenameWindow,
+		SessionArgs: true,
+	})
+}
+
+type tmuxWindow struct {
+	Index  int
+	Name   string
+	Pinned bool // set by pin-window
+}
+
+// pinnedOption is the tmux window option that marks windows pinned by tsm.
+const pinnedOption = "@tsm-pinned"
+
+func listWindows(ctx context.Context, sess string) ([]tmuxWindow, error) {
+	out, err := shell.Output(ctx, "tmux", "list-windows", "-t", sess, "-F", "#{window_index}\t#{window_name}\t#{"+pinnedOption+"}")
+	if err != nil {
+		return nil, err
+	}
+	var res []tmuxWindow
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		f := strings.SplitN(sc.Text(), "\t", 3)
+		if len(f) < 2 {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(f[0]))
+		if err != nil {
+			continue
+		}
+		res = append(res, tmuxWindow{Index: n, Name: f[1], Pinned: len(f) == 3 && f[2] == "1"})
+	}
+	return res, nil
+}
+
+// resolveWindow turns a window name (case-insensitive) or index into a
+// "<session>:<index>" target.
+func resolveWindow(ctx context.Context, sess, ref string) (string, error) {
+	if _, err := strconv.Atoi(ref); err == nil {
+		return sess + ":" + ref, nil
+	}
+	wins, err := listWindows(ctx, sess)
+	if err != nil {
+		return "", err
+	}
+	for _, w := range wins {
+		if strings.EqualFold(w.Name, ref) {
+			return fmt.Sprintf("%s:%d", sess, w.Index), nil
+		}
+	}
+	return "", fmt.Errorf("no window %q in session %s", ref, sess)
+}
+
+func runRenameWindow(opts Options, args []string) error {
+	if len(args) != 3 {
+		return errors.New("usage: tsm rename-window <session> <old-name|index> <new-name>")
+	}
+	sess, old, name := args[0], args[1], args[2]
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	target, err := resolveWindow(ctx, sess, old)
+	if err != nil {
+		return err
+	}
+	return shell.Run(ctx, "tmux", "rename-window", "-t", target, name)
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "list-windows",
+		Summary:     "List the windows of a session, marking pinned ones: list-windows <session>",
+		Run:         runListWindows,
+		SessionArgs: true,
+	})
+	registerCommand(Command{
+		Name:    "pin-window",
+		Summary: "Keep a window open after its command exits: pin-window <session>:<window>",
+		Run:     runPinWindow,
+	})
+	registerCommand(Command{
+		Name:    "unpin-window",
+		Summary: "Undo pin-window: unpin-window <session>:<window>",
+		Run:     runUnpinWindow,
+	})
+}
+
+func runListWindows(opts Options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tsm list-windows <session>")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, args[0]) {
+		return fmt.Errorf("%w: %s", ErrNoSession, args[0])
+	}
+	wins, err := listWindows(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, w := range wins {
+		marker := ""
+		if w.Pinned {
+			marker = glyph("📌", "[P]")
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\n", w.Index, w.Name, marker)
+	}
+	return tw.Flush()
+}
+
+func runPinWindow(opts Options, args []string) error {
+	return runPinCommand(opts, "pin-window", args, [][]string{
+		{"remain-on-exit", "on"},
+		{pinnedOption, "1"},
+	})
+}
+
+func runUnpinWindow(opts Options, args []string) error {
+	return runPinCommand(opts, "unpin-window", args, [][]string{
+		{"-u", "remain-on-exit"},
+		{"-u", pinnedOption},
+	})
+}
+
+// runPinCommand resolves a <session>:<window> argument and applies each
+// set-window-option argument list to it.
+func runPinCommand(opts Options, name string, args []string, options [][]string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tsm %s <session>:<window>", name)
+	}
+	sess, win, ok := strings.Cut(args[0], ":")
+	if !ok || sess == "" || win == "" {
+		return fmt.Errorf("usage: tsm %s <session>:<window>", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	target, err := resolveWindow(ctx, sess, win)
+	if err != nil {
+		return err
+	}
+	for _, opt := range options {
+		if err := shell.Run(ctx, "tmux", slices.Concat([]string{"set-window-option", "-t", target}, opt)...); err != nil {
+			return fmt.Errorf("%s %s: %w", name, target, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "rename",
+		Summary:     "Rename a session and carry over its link and bookmark: rename <old> <new>",
+		Run:         runRename,
+		SessionArgs: true,
+	})
+}
+
+func runRename(opts Options, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: tsm rename <old> <new>")
+	}
+	old, name := args[0], sanitize(args[1])
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, old) {
+		return fmt.Errorf("%w: %s", ErrNoSession, old)
+	}
+	if name == old {
+		return nil
+	}
+	if hasSession(ctx, name) {
+		return fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	if err := shell.Run(ctx, "tmux", "rename-session", "-t", old, name); err != nil {
+		return err
+	}
+	fmt.Printf("%s -> %s\n", old, name)
+
+	if err := renameLinks([]sessionRename{{Old: old, New: name}}); err != nil {
+		return err
+	}
+	return renameBookmark(opts.ConfigPath, old, name)
+}
+
+// sessionRename is one tmux rename-session, old name → new name.
+type sessionRename struct {
+	Old, New string
+}
+
+// renameLinks moves the links of renamed sessions. Renames apply in order,
+// so a chain like a → b, b → c carries a's link to c.
+func renameLinks(renames []sessionRename) error {
+	links, err := loadLinks()
+	if err != nil {
+		return nil // no links to carry over
+	}
+	changed := false
+	for _, r := range renames {
+		if dir, ok := links[r.Old]; ok {
+			delete(links, r.Old)
+			links[r.New] = dir
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveLinks(links)
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "lock",
+		Summary:     "Lock a session for reference use: lock <session>",
+		Run:         runLock,
+		SessionArgs: true,
+	})
+	registerCommand(Command{
+		Name:        "unlock",
+		Summary:     "Undo lock: unlock <session>",
+		Run:         runUnlock,
+		SessionArgs: true,
+	})
+}
+
+// lockedOption is the tmux user option that marks sessions locked by tsm.
+const lockedOption = "@tsm-locked"
+
+// lockedSessions returns the sessions marked with lockedOption.
+func lockedSessions(ctx context.Context) map[string]bool {
+	out, err := shell.Output(ctx, "tmux", "list-sessions", "-F", "#{session_name}\t#{"+lockedOption+"}")
+	if err != nil {
+		return nil
+	}
+	res := map[string]bool{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if name, v, _ := strings.Cut(sc.Text(), "\t"); v == "1" {
+			res[name] = true
+		}
+	}
+	return res
+}
+
+// lockSession keeps the panes of sess open after their commands exit,
+// locks its clients and marks it for the picker.
+func lockSession(ctx context.Context, sess string) error {
+	for _, args := range [][]string{
+		{"set-option", "-t", sess, "remain-on-exit", "on"},
+		{"set-option", "-t", sess, lockedOption, "1"},
+		{"lock-session", "-t", sess},
+	} {
+		if err := shell.Run(ctx, "tmux", args...); err != nil {
+			return fmt.Errorf("lock %s: %w", sess, err)
+		}
+	}
+	return nil
+}
+
+// unlockSession reverts lockSession; a client still showing the lock
+// command unlocks it itself.
+func unlockSession(ctx context.Context, sess string) error {
+	for _, args := range [][]string{
+		{"set-option", "-t", sess, "-u", "remain-on-exit"},
+		{"set-option", "-t", sess, "-u", lockedOption},
+	} {
+		if err := shell.Run(ctx, "tmux", args...); err != nil {
+			return fmt.Errorf("unlock %s: %w", sess, err)
+		}
+	}
+	return nil
+}
+
+func runLock(opts Options, args []string) error {
+	return runLockCommand(opts, "lock", args, lockSession)
+}
+
+func runUnlock(opts Options, args []string) error {
+	return runLockCommand(opts, "unlock", args, unlockSession)
+}
+
+func runLockCommand(opts Options, name string, args []string, fn func(context.Context, string) error) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tsm %s <session>", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, args[0]) {
+		return fmt.Errorf("%w: %s", ErrNoSession, args[0])
+	}
+	return fn(ctx, args[0])
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "rename-batch",
+		Summary: "Rename the sessions listed in a CSV file of old_name,new_name rows: rename-batch <csv-file>",
+		Run:     runRenameBatch,
+	})
+}
+
+// renameBatch renames sessions by rows of old_name,new_name, writing one
+// line per row to w. A missing old session is a warning; an existing new
+// name or a tmux failure is an error. It returns the renames that happened,
+// in row order, and the number of errors.
+func renameBatch(ctx context.Context, w io.Writer, rows [][]string) ([]sessionRename, int) {
+	var renamed []sessionRename
+	failed := 0
+	for i, row := range rows {
+		if i == 0 && slices.Equal(row, []string{"old_name", "new_name"}) {
+			continue // header
+		}
+		if len(row) != 2 || row[0] == "" || row[1] == "" {
+			fmt.Fprintf(w, "error: row %d: want old_name,new_name, got %q\n", i+1, row)
+			failed++
+			continue
+		}
+		old, name := row[0], sanitize(row[1])
+		switch {
+		case !hasSession(ctx, old):
+			fmt.Fprintf(w, "warning: %s: %v, skipped\n", old, ErrNoSession)
+		case name == old:
+		case hasSession(ctx, name):
+			fmt.Fprintf(w, "error: %s -> %s: %v\n", old, name, ErrSessionExists)
+			failed++
+		default:
+			if err := shell.Run(ctx, "tmux", "rename-session", "-t", old, name); err != nil {
+				fmt.Fprintf(w, "error: %s -> %s: %v\n", old, name, err)
+				failed++
+				continue
+			}
+			renamed = append(renamed, sessionRename{Old: old, New: name})
+		}
+	}
+	return renamed, failed
+}
+
+func runRenameBatch(opts Options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tsm rename-batch <csv-file>")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1 // renameBatch reports malformed rows
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	renamed, failed := renameBatch(ctx, os.Stderr, rows)
+	for _, r := range renamed {
+		fmt.Printf("%s -> %s\n", r.Old, r.New)
+	}
+	fmt.Printf("renamed %d sessions\n", len(renamed))
+	if err := renameLinks(renamed); err != nil {
+		return err
+	}
+	if err := renameHistory(renamed); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d rows failed", failed)
+	}
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "replay",
+		Summary:     "Record pane output: replay -start|-stop|-view <session>",
+		Run:         runReplay,
+		SessionArgs: true,
+	})
+}
+
+func recordingPath(sess string) (string, error) {
+	dir, err := xdgDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recordings", sanitize(sess)+".log"), nil
+}
+
+// shellQuote single-quotes s for /bin/sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// pagerCommand returns $PAGER split into words, so values such as "less -R"
+// work, or less when it is unset.
+func pagerCommand() ([]string, error) {
+	if p := strings.TrimSpace(os.Getenv("PAGER")); p != "" {
+		words, err := splitShellWords(p)
+		if err != nil {
+			return nil, fmt.Errorf("$PAGER: %w", err)
+		}
+		return words, nil
+	}
+	return []string{"less"}, nil
+}
+
+// pageFile opens path in $PAGER.
+func pageFile(path string) error {
+	pager, err := pagerCommand()
+	if err != nil {
+		return err
+	}
+	// no timeout: the pager runs until the user quits it
+	return shell.Run(context.Background(), pager[0], append(pager[1:], path)...)
+}
+
+func runReplay(opts Options, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	start := fs.Bool("start", false, "Start recording the session's active pane")
+	stop := fs.Bool("stop", false, "Stop recording")
+	view := fs.Bool("view", false, "Open the recording in $PAGER")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || btoi(*start)+btoi(*stop)+btoi(*view) != 1 {
+		return errors.New("usage: tsm replay -start|-stop|-view <session>")
+	}
+	sess := fs.Arg(0)
+	logPath, err := recordingPath(sess)
+	if err != nil {
+		return err
+	}
+
+	if *view {
+		if _, err := os.Stat(logPath); err != nil {
+			return fmt.Errorf("no recording for %s: %w", sess, err)
+		}
+		return pageFile(logPath)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	if *stop {
+		return shell.Run(ctx, "tmux", "pipe-pane", "-t", sess)
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		return err
+	}
+	if err := shell.Run(ctx, "tmux", "pipe-pane", "-t", sess, "-o", "cat >> "+shellQuote(logPath)); err != nil {
+		return err
+	}
+	fmt.Printf("Recording %s → %s\n", sess, logPath)
+	return nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "session-age",
+		Summary:     "Show how long sessions have been running: session-age [-older-than D] [session]",
+		Run:         runSessionAge,
+		SessionArgs: true,
+	})
+}
+
+func sessionCreated(ctx context.Context, sess string) (time.Time, error) {
+	out, err := shell.Output(ctx, "tmux", "display-message", "-t", sess, "-p", "#{session_created}")
+	if err != nil {
+		return time.Time{}, err
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad session_created for %s: %w", sess, err)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// sessionLastAttached returns when sess was last attached, or its creation
+// time if it never was, and whether a client is attached now.
+func sessionLastAttached(ctx context.Context, sess string) (time.Time, bool, error) {
+	out, err := shell.Output(ctx, "tmux", "display-message", "-t", sess, "-p",
+		"#{session_attached} #{session_last_attached} #{session_created}")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	f := strings.Fields(string(out))
+	if len(f) == 2 { // never attached: session_last_attached is empty
+		f = []string{f[0], f[1], f[1]}
+	}
+	if len(f) != 3 {
+		return time.Time{}, false, fmt.Errorf("bad session_last_attached for %s: %q", sess, out)
+	}
+	secs, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("bad session_last_attached for %s: %w", sess, err)
+	}
+	return time.Unix(secs, 0), f[0] != "0", nil
+}
+
+// killIdleSessions kills every session without clients that was last
+// attached more than timeout before now, warning about each one.
+func killIdleSessions(ctx context.Context, timeout time.Duration, now time.Time) {
+	sessions, err := tmuxSessions(ctx)
+	if err != nil {
+		return // no server, nothing to kill
+	}
+	for _, s := range sessions {
+		last, attached, err := sessionLastAttached(ctx, s)
+		if err != nil {
+			slog.Debug("session_idle_timeout: skipping", "session", s, "err", err)
+			continue
+		}
+		if idle := now.Sub(last); !attached && idle > timeout {
+			if err := killSession(ctx, s); err != nil {
+				slog.Warn("idle session not killed", "session", s, "err", err)
+				continue
+			}
+			slog.Warn("killed idle session", "session", s, "idle", formatAge(idle))
+		}
+	}
+}
+
+// formatAge renders d as "3d 14h 27m", dropping leading zero units.
+func formatAge(d time.Duration) string {
+	d = d.Truncate(time.Minute)
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	mins := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, mins)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, mins)
+	default:
+		return fmt.Sprintf("%dm", mins)
+	}
+}
+
+// parseDuration is time.ParseDuration that also accepts a "d" (day) unit,
+// e.g. "2d" or "1d12h".
+func parseDuration(s string) (time.Duration, error) {
+	var days time.Duration
+	if i := strings.Index(s, "d"); i > 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		days, s = time.Duration(n)*24*time.Hour, s[i+1:]
+		if s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	return days + d, err
+}
+
+func runSessionAge(opts Options, args []string) error {
+	fs := flag.NewFlagSet("session-age", flag.ContinueOnError)
+	olderThan := fs.String("older-than", "", "Only list sessions older than this duration (e.g. 2h, 3d)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var minAge time.Duration
+	if *olderThan != "" {
+		d, err := parseDuration(*olderThan)
+		if err != nil {
+			return err
+		}
+		minAge = d
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	now := time.Now()
+
+	if fs.NArg() == 1 {
+		sess := fs.Arg(0)
+		if !hasSession(ctx, sess) {
+			return fmt.Errorf("%w: %s", ErrNoSession, sess)
+		}
+		created, err := sessionCreated(ctx, sess)
+		if err != nil {
+			return err
+		}
+		fmt.Println(formatAge(now.Sub(created)))
+		return nil
+	}
+
+	type row struct {
+		name string
+		age  time.Duration
+	}
+	var rows []row
+	for _, s := range listTmuxSessions(ctx) {
+		created, err := sessionCreated(ctx, s)
+		if err != nil {
+			continue
+		}
+		if age := now.Sub(created); age >= minAge {
+			rows = append(rows, row{s, age})
+		}
+	}
+	slices.SortFunc(rows, func(a, b row) int { return cmp.Compare(b.age, a.age) })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SESSION\tAGE")
+	for _, r := range rows {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", r.name, formatAge(r.age))
+	}
+	return tw.Flush()
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "set-pane-title",
+		Summary:     "Set a pane title: set-pane-title [session [window [pane]]] <title>",
+		Run:         runSetPaneTitle,
+		SessionArgs: true,
+	})
+}
+
+// validatePaneTitle rejects titles tmux would expand as a format string
+// or that would corrupt the status line.
+func validatePaneTitle(title string) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("title must not be empty")
+	}
+	for _, r := range title {
+		if r == '#' || unicode.IsControl(r) {
+			return fmt.Errorf("title contains unsupported character %q", r)
+		}
+	}
+	return nil
+}
+
+// paneTarget builds a tmux target from optional session/window/pane parts;
+// omitted parts fall back to the current/active one.
+func paneTarget(parts []string) string {
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return parts[0] + ":"
+	case 2:
+		return parts[0] + ":" + parts[1]
+	default:
+		return parts[0] + ":" + parts[1] + "." + parts[2]
+	}
+}
+
+func runSetPaneTitle(opts Options, args []string) error {
+	if len(args) < 1 || len(args) > 4 {
+		return errors.New("usage: tsm set-pane-title [session [window [pane]]] <title>")
+	}
+	title, parts := args[len(args)-1], args[:len(args)-1]
+	if err := validatePaneTitle(title); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if len(parts) == 0 {
+		if !isInTmux() {
+			return errors.New("not inside tmux; pass a session")
+		}
+		return shell.Run(ctx, "tmux", "select-pane", "-T", title)
+	}
+	if !hasSession(ctx, parts[0]) {
+		return fmt.Errorf("%w: %s", ErrNoSession, parts[0])
+	}
+	return shell.Run(ctx, "tmux", "select-pane", "-t", paneTarget(parts), "-T", title)
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "new-window-here",
+		Summary: "Open a tmux window in the current session at the working directory",
+		Run:     runNewWindowHere,
+	})
+}
+
+func runNewWindowHere(opts Options, _ []string) error {
+	if !isInTmux() {
+		return errors.New("not inside tmux")
+	}
+	cwd := os.Getenv("PWD")
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	return shell.Run(ctx, "tmux", "new-window", "-c", cwd, "-n", sanitize(filepath.Base(cwd)))
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "pager",
+		Summary:     "View every pane of a session in $PAGER: pager [-lines N] <session>",
+		Run:         runPager,
+		SessionArgs: true,
+	})
+}
+
+// capturePanes returns the content of all panes in sess, each preceded by a
+// "==> session:window.pane <==" header. lines > 0 keeps only the last lines
+// of each pane.
+func capturePanes(ctx context.Context, sess string, lines int) (string, error) {
+	out, err := shell.Output(ctx, "tmux", "list-panes", "-s", "-t", sess, "-F", "#{window_index}.#{pane_index}")
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for pane := range strings.FieldsSeq(string(out)) {
+		target := sess + ":" + pane
+		args := []string{"capture-pane", "-p", "-t", target}
+		if lines > 0 {
+			args = append(args, "-S", "-"+strconv.Itoa(lines))
+		}
+		content, err := shell.Output(ctx, "tmux", args...)
+		if err != nil {
+			return "", err
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "==> %s <==\n", target)
+		b.WriteString(lastLines(string(content), lines))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// lastLines drops the blank lines below a pane's output, then keeps the last
+// n lines (all when n <= 0). `capture-pane -S -n` alone is not enough: it
+// adds the n scrollback lines to the whole visible pane.
+func lastLines(content string, n int) string {
+	lines := strings.Split(strings.TrimRight(content, " \n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func runPager(opts Options, args []string) error {
+	fs := flag.NewFlagSet("pager", flag.ContinueOnError)
+	lines := fs.Int("lines", 0, "Only capture the last N lines of each pane")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *lines < 0 {
+		return errors.New("usage: tsm pager [-lines N] <session>")
+	}
+	sess := fs.Arg(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	text, err := capturePanes(ctx, sess, *lines)
+	if err != nil {
+		return err
+	}
+	return pageText(text)
+}
+
+// pageText shows text in $PAGER through a temporary file.
+func pageText(text string) error {
+	f, err := os.CreateTemp("", "tsm-pager-*.txt")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err := f.WriteString(text); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return pageFile(f.Name())
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "env-diff",
+		Summary:     "Compare the tmux environments of two sessions: env-diff <session1> <session2>",
+		Run:         runEnvDiff,
+		SessionArgs: true,
+	})
+}
+
+// sessionEnv parses `tmux show-environment -t sess`. Variables tmux marks
+// as removed ("-NAME") are left out.
+func sessionEnv(ctx context.Context, sess string) (map[string]string, error) {
+	out, err := shell.Output(ctx, "tmux", "show-environment", "-t", sess)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, val, ok := strings.Cut(sc.Text(), "=")
+		if ok && !strings.HasPrefix(key, "-") {
+			env[key] = val
+		}
+	}
+	return env, sc.Err()
+}
+
+// envDiffLines compares two environments: "- K=V" only in a, "+ K=V" only
+// in b and "~ K: A → B" when the values differ, sorted by key.
+func envDiffLines(a, b map[string]string, color bool) []string {
+	keys := slices.Sorted(maps.Keys(a))
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	var lines []string
+	for _, k := range keys {
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inB:
+			lines = append(lines, paint("- "+k+"="+va, sgrRed, color))
+		case !inA:
+			lines = append(lines, paint("+ "+k+"="+vb, sgrGreen, color))
+		case va != vb:
+			lines = append(lines, paint(fmt.Sprintf("~ %s: %s → %s", k, va, vb), sgrYellow, color))
+		}
+	}
+	return lines
+}
+
+func runEnvDiff(opts Options, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: tsm env-diff <session1> <session2>")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	envs := make([]map[string]string, 2)
+	for i, sess := range args {
+		if !hasSession(ctx, sess) {
+			return fmt.Errorf("%w: %s", ErrNoSession, sess)
+		}
+		env, err := sessionEnv(ctx, sess)
+		if err != nil {
+			return err
+		}
+		envs[i] = env
+	}
+	lines := envDiffLines(envs[0], envs[1], colorOutput(os.Stdout))
+	if len(lines) == 0 {
+		fmt.Println("Environments are identical")
+		return nil
+	}
+	fmt.Printf("--- %s\n+++ %s\n", args[0], args[1])
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:    "session-count",
+		Summary: "Print the number of tmux sessions (exit 1 if none, 2 if tmux isn't running)",
+		Run:     runSessionCount,
+	})
+}
+
+// sessionCount returns the number of sessions and the exit status
+// session-count reports it with.
+func sessionCount(ctx context.Context) (int, exitStatus) {
+	sessions, err := tmuxSessions(ctx)
+	switch {
+	case err != nil:
+		return 0, 2
+	case len(sessions) == 0:
+		return 0, 1
+	default:
+		return len(sessions), 0
+	}
+}
+
+func runSessionCount(opts Options, _ []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	n, st := sessionCount(ctx)
+	fmt.Println(n)
+	if st != 0 {
+		return st
+	}
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "wait",
+		Summary:     "Block until a session exists: wait [-timeout 30s] <session> (exit 1 on timeout, 2 on errors)",
+		Run:         runWait,
+		SessionArgs: true,
+	})
+}
+
+// waitPollInterval is how often wait checks for the session.
+const waitPollInterval = 500 * time.Millisecond
+
+// waitForSession polls for sess every interval until it exists or timeout
+// passes, returning the time waited and whether it appeared.
+func waitForSession(sess string, timeout, interval time.Duration) (time.Duration, bool) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if hasSession(ctx, sess) {
+			return time.Since(start), true
+		}
+		select {
+		case <-ctx.Done():
+			return time.Since(start), false
+		case <-tick.C:
+		}
+	}
+}
+
+func runWait(_ Options, args []string) error {
+	fs := flag.NewFlagSet("wait", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "Give up after this long")
+	if err := fs.Parse(args); err != nil {
+		return exitStatus(2)
+	}
+	sess := fs.Arg(0)
+	if fs.NArg() > 1 { // flags may also follow the session name
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return exitStatus(2)
+		}
+		if fs.NArg() > 0 {
+			sess = ""
+		}
+	}
+	if sess == "" {
+		logError("tsm wait failed", errors.New("usage: tsm wait [-timeout 30s] <session>"))
+		return exitStatus(2)
+	}
+	if !shell.IsAvailable("tmux") {
+		logError("tsm wait failed", fmt.Errorf("%w: not found in PATH", ErrNoTmux))
+		return exitStatus(2)
+	}
+	waited, ok := waitForSession(sess, *timeout, waitPollInterval)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "timed out after %s waiting for %s\n", waited.Round(time.Millisecond), sess)
+		return exitStatus(1)
+	}
+	fmt.Printf("%s is up after %s\n", sess, waited.Round(time.Millisecond))
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "watch-session",
+		Summary:     "Attach read-only to watch a session: watch-session [-pane N] <session>",
+		Run:         runWatchSession,
+		SessionArgs: true,
+	})
+}
+
+// watchTarget returns the attach target for sess, or for pane n of its
+// current window when n >= 0.
+func watchTarget(sess string, n int) string {
+	if n < 0 {
+		return sess
+	}
+	return sess + ":." + strconv.Itoa(n)
+}
+
+func runWatchSession(opts Options, args []string) error {
+	fs := flag.NewFlagSet("watch-session", flag.ContinueOnError)
+	pane := fs.Int("pane", -1, "Attach to this pane of the session's current window")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tsm watch-session [-pane N] <session>")
+	}
+	sess := fs.Arg(0)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	if !hasSession(ctx, sess) {
+		return fmt.Errorf("%w: %s", ErrNoSession, sess)
+	}
+	// Attaching to a pane makes it the window's active pane for every
+	// client, so note the active pane now and put it back on detach.
+	prev := ""
+	if *pane >= 0 {
+		out, err := shell.Output(ctx, "tmux", "display-message", "-p", "-t", sess, "#{pane_index}")
+		if err == nil {
+			prev = strings.TrimSpace(string(out))
+		}
+	}
+	// tmux refuses to attach from inside a session unless $TMUX is unset;
+	// watching from another pane is the point, so nest on purpose.
+	_ = os.Unsetenv("TMUX")
+	// the attach lasts until the user detaches, so it gets no timeout
+	err := shell.Run(context.Background(), "tmux", "attach", "-r", "-t", watchTarget(sess, *pane))
+	if prev != "" {
+		rctx, rcancel := context.WithTimeout(context.Background(), opts.timeout())
+		defer rcancel()
+		_ = shell.Run(rctx, "tmux", "select-pane", "-t", sess+":."+prev)
+	}
+	return err
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "kill-all",
+		Summary:     "Kill every session matching a glob or fuzzy pattern: kill-all [-yes] [pattern]",
+		Run:         runKillAll,
+		SessionArgs: true,
+	})
+}
+
+// matchSessions returns the sessions matching pattern: a glob when it
+// contains *, ? or [, else a fuzzy query under m. An empty pattern matches
+// every session.
+func matchSessions(sessions []string, pattern string, m MatchOptions) ([]string, error) {
+	glob := strings.ContainsAny(pattern, "*?[")
+	if glob {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+	var out []string
+	for _, s := range sessions {
+		ok := fuzzyScore(pattern, s, m) >= 0
+		if glob {
+			ok, _ = filepath.Match(pattern, s)
+		}
+		if ok {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func runKillAll(opts Options, args []string) error {
+	fs := flag.NewFlagSet("kill-all", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "Kill without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: tsm kill-all [-yes] [pattern]")
+	}
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := cfg.matchOptions()
+	if err != nil {
+		return err
+	}
+	if !shell.IsAvailable("tmux") {
+		return fmt.Errorf("%w: not found in PATH", ErrNoTmux)
+	}
+
+	lctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	sessions := listTmuxSessions(lctx)
+	cancel()
+	victims, err := matchSessions(sessions, fs.Arg(0), m)
+	if err != nil {
+		return err
+	}
+	if len(victims) == 0 {
+		fmt.Println("No matching sessions.")
+		return nil
+	}
+	for _, s := range victims {
+		fmt.Println(s)
+	}
+	if !*yes && !confirm(fmt.Sprintf("Kill %d session(s)?", len(victims))) {
+		return nil
+	}
+	// The timeout starts after the prompt, which may wait on the user.
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	var errs []error
+	for _, s := range victims {
+		if err := killSession(ctx, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	fmt.Printf("Killed %d session(s).\n", len(victims)-len(errs))
+	return errors.Join(errs...)
+}
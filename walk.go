@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ---------------- Symlink-following walk ----------------
+
+// walkDirFollow behaves like filepath.WalkDir but also descends into
+// symlinked directories. Directories are tracked by device and inode so
+// circular links are visited once; where inodes are unavailable, loops are
+// bounded only by the caller's max_depth.
+func walkDirFollow(root string, fn fs.WalkDirFunc) error {
+	fi, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	visited := map[dirID]bool{}
+	err = walkFollow(root, fs.FileInfoToDirEntry(fi), fn, visited)
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// dirID identifies a directory across symlinks: inode numbers are only
+// unique within one device.
+type dirID struct{ dev, ino uint64 }
+
+func walkFollow(path string, d fs.DirEntry, fn fs.WalkDirFunc, visited map[dirID]bool) error {
+	if d.Type()&fs.ModeSymlink != 0 {
+		fi, err := os.Stat(path) // resolve the link target
+		if err != nil {
+			return fn(path, d, err)
+		}
+		d = fs.FileInfoToDirEntry(fi)
+	}
+	if err := fn(path, d, nil); err != nil {
+		if errors.Is(err, fs.SkipDir) && d.IsDir() {
+			return nil // skips this directory only; d is the resolved entry
+		}
+		return err
+	}
+	if !d.IsDir() {
+		return nil
+	}
+
+	// d is resolved by now, so Info returns the link target's stat
+	if fi, err := d.Info(); err == nil {
+		if dev, ino, ok := fileInode(fi); ok {
+			id := dirID{dev, ino}
+			if visited[id] {
+				return nil
+			}
+			visited[id] = true
+		}
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if err := fn(path, d, err); err != nil && !errors.Is(err, fs.SkipDir) {
+			return err
+		}
+		return nil
+	}
+	for _, e := range entries {
+		if err := walkFollow(filepath.Join(path, e.Name()), e, fn, visited); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				return nil // SkipDir on a file skips the rest of this directory
+			}
+			return err
+		}
+	}
+	return nil
+}
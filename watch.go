@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ---------------- Config watching ----------------
+
+const configPollInterval = time.Second
+
+// watchConfig polls path's mtime and size and calls onChange whenever they
+// differ from the last observation. It returns when ctx is done. Polling is
+// used instead of inotify so editors that replace the file are handled too.
+func watchConfig(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	stamp := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+	lastMod, lastSize := stamp()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			mod, size := stamp()
+			if mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			onChange()
+		}
+	}
+}
+
+// watchItems relists the candidates with listItems whenever the config file
+// changes. Only the newest list is kept in the returned channel.
+func watchItems(ctx context.Context, opts Options, path string) <-chan []Item {
+	ch := make(chan []Item, 1)
+	go watchConfig(ctx, path, configPollInterval, func() {
+		cfg, err := loadRunConfig(opts)
+		if err != nil {
+			slog.Warn("config reload failed; keeping current list", "err", err)
+			return
+		}
+		bctx, cancel := context.WithTimeout(ctx, opts.timeout())
+		items, err := listItems(bctx, cfg, opts)
+		cancel()
+		if err != nil {
+			slog.Warn("config reload failed; keeping current list", "err", err)
+			return
+		}
+		select {
+		case <-ch: // drop a stale list nobody picked up yet
+		default:
+		}
+		ch <- items
+	})
+	return ch
+}